@@ -0,0 +1,34 @@
+// Command snippetctl works with a Snippetbox server from the terminal. It talks to the
+// server's JSON API, authenticating with a personal API token which "snippetctl login"
+// creates and saves in a dotfile.
+//
+// Usage:
+//
+//	snippetctl login [-server URL] [-email EMAIL] [-insecure]
+//	snippetctl create -t TITLE [-e DAYS] [-visibility V] [-language L] [-format F] [-tags T] < FILE
+//	snippetctl get [-json] ID
+//	snippetctl list [-json] [-page N] [-per-page N]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/DataDavD/snippetbox/pkg/cli"
+)
+
+func main() {
+	c := &cli.Command{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := c.Run(os.Args[1:]); err != nil {
+		switch {
+		case errors.Is(err, flag.ErrHelp):
+			os.Exit(0)
+		case errors.Is(err, cli.ErrUsage):
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "snippetctl: %s\n", err)
+		os.Exit(1)
+	}
+}
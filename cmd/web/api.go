@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/forms"
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// The handlers in this file make up the JSON API, which is mounted under /api/v1. They
+// mirror the HTML handlers, and share their validation rules and visibility checks.
+
+// apiSnippetInput is the JSON request body used to create or update a snippet. The expiry
+// is given by one of Expires, the number of days until the snippet expires, ExpiresAt, the
+// time it expires (to the minute), or NeverExpires. Visibility, Language and Format default
+// to public, plain text snippets if they're left out. MaxViews makes a new snippet burn
+// after reading, deleting it after that many views; it's ignored when updating a snippet.
+// Password protects the snippet with a password, or removes its password if it's empty;
+// leaving it out keeps the current password. Encrypted marks Content as the ciphertext of a
+// client-side encrypted snippet; a snippet stays encrypted or unencrypted when it's updated.
+type apiSnippetInput struct {
+	Title        string     `json:"title"`
+	Content      string     `json:"content"`
+	Expires      int        `json:"expires"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	NeverExpires bool       `json:"never_expires"`
+	Visibility   string     `json:"visibility"`
+	Language     string     `json:"language"`
+	Format       string     `json:"format"`
+	Tags         []string   `json:"tags"`
+	MaxViews     int        `json:"max_views"`
+	Password     *string    `json:"password"`
+	Encrypted    bool       `json:"encrypted"`
+}
+
+// form converts the input into the values of the snippet form, so that API requests are
+// validated with exactly the same rules as the HTML form.
+func (in *apiSnippetInput) form() *forms.Form {
+	values := url.Values{}
+	values.Set("title", in.Title)
+	values.Set("content", in.Content)
+	switch {
+	case in.NeverExpires:
+		values.Set("expires", expiresNever)
+	case in.ExpiresAt != nil:
+		values.Set("expires", expiresDate)
+		values.Set("expires_at", in.ExpiresAt.UTC().Format(expiresAtLayout))
+	case in.Expires != 0:
+		values.Set("expires", strconv.Itoa(in.Expires))
+	}
+	values.Set("visibility", in.Visibility)
+	if in.Visibility == "" {
+		values.Set("visibility", models.VisibilityPublic)
+	}
+	values.Set("language", in.Language)
+	if in.Language == "" {
+		values.Set("language", "text")
+	}
+	values.Set("format", in.Format)
+	if in.Format == "" {
+		values.Set("format", models.FormatPlain)
+	}
+	values.Set("tags", strings.Join(in.Tags, ","))
+	if in.Encrypted {
+		values.Set("encrypted", "true")
+	}
+	if in.MaxViews != 0 {
+		values.Set("max_views", strconv.Itoa(in.MaxViews))
+	}
+	if in.Password != nil {
+		if *in.Password == "" {
+			values.Set("remove_password", "true")
+		} else {
+			values.Set("password", *in.Password)
+		}
+	}
+
+	form := forms.NewForm(values)
+	validateSnippetForm(form, nil)
+	return form
+}
+
+// apiSnippetList is the JSON response body listing a page of snippets. Next is the URL of
+// the next page, if there is one.
+type apiSnippetList struct {
+	Snippets []*models.Snippet `json:"snippets"`
+	Page     int               `json:"page"`
+	PerPage  int               `json:"per_page"`
+	Total    int               `json:"total"`
+	Next     string            `json:"next,omitempty"`
+}
+
+// apiListSnippets lists the public snippets, newest first. Like the browse page, it's
+// paginated with the "page" and "per_page" query string parameters, and the "after" cursor
+// used in the Next URL keeps deep pages fast.
+func (app *application) apiListSnippets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	list := &apiSnippetList{Page: 1, PerPage: 20}
+	var err error
+	if v := query.Get("page"); v != "" {
+		if list.Page, err = strconv.Atoi(v); err != nil || list.Page < 1 {
+			app.apiClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("per_page"); v != "" {
+		if list.PerPage, err = strconv.Atoi(v); err != nil || list.PerPage < 1 || list.PerPage > 100 {
+			app.apiClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var cursor *models.Cursor
+	if v := query.Get("after"); v != "" {
+		if cursor, err = parseCursor(v, false); err != nil {
+			app.apiClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	list.Snippets, list.Total, err = app.snippets.Page(cursor, (list.Page-1)*list.PerPage,
+		list.PerPage)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// Encode an empty page as [] rather than null.
+	if list.Snippets == nil {
+		list.Snippets = []*models.Snippet{}
+	}
+
+	if n := len(list.Snippets); n > 0 && list.Page*list.PerPage < list.Total {
+		list.Next = fmt.Sprintf("/api/v1/snippets?page=%d&per_page=%d&after=%s", list.Page+1,
+			list.PerPage, formatCursor(list.Snippets[n-1]))
+	}
+
+	app.writeJSON(w, http.StatusOK, list)
+}
+
+// apiShowSnippet sends a single snippet, with the same visibility rules as its page. The API
+// has no session to unlock password-protected snippets in, so only their authors can fetch
+// them.
+func (app *application) apiShowSnippet(w http.ResponseWriter, r *http.Request) {
+	s, err := app.findSnippet(r)
+	if err == nil && s.Protected && s.UserID != app.authenticatedUserID(r) {
+		err = models.ErrNoRecord
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, s)
+}
+
+// apiCreateSnippet creates a snippet from a JSON request body, owned by the authenticated
+// user. It responds with the new snippet, and its API URL in the Location header.
+func (app *application) apiCreateSnippet(w http.ResponseWriter, r *http.Request) {
+	var in apiSnippetInput
+	if !app.readJSON(w, r, &in) {
+		return
+	}
+
+	form := in.form()
+	if !form.Valid() {
+		app.apiValidationError(w, form)
+		return
+	}
+
+	s := formSnippet(form)
+	s.UserID = app.authenticatedUserID(r)
+	id, _, err := app.snippets.Insert(s)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	if err = app.snippets.SetTags(id, formTags(form)); err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// Fetch the snippet back from the database, so that the response includes fields like
+	// the author and creation time.
+	if s, err = app.snippets.Get(id); err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.events.Notify(models.EventSnippetCreated, s)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+	app.writeJSON(w, http.StatusCreated, s)
+}
+
+// apiUpdateSnippet replaces a snippet with the JSON request body. Only the author of the
+// snippet is allowed to update it.
+func (app *application) apiUpdateSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.apiOwnSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var in apiSnippetInput
+	if !app.readJSON(w, r, &in) {
+		return
+	}
+
+	in.Encrypted = s.Encrypted
+	form := in.form()
+	if !form.Valid() {
+		app.apiValidationError(w, form)
+		return
+	}
+
+	updated := formSnippet(form)
+	updated.ID, updated.UserID = s.ID, app.authenticatedUserID(r)
+	err := app.snippets.Update(updated)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	if err = app.snippets.SetTags(s.ID, formTags(form)); err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	if s, err = app.snippets.Get(s.ID); err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.events.Notify(models.EventSnippetUpdated, s)
+
+	app.writeJSON(w, http.StatusOK, s)
+}
+
+// apiDeleteSnippet deletes a snippet. Only the author of the snippet is allowed to delete
+// it.
+func (app *application) apiDeleteSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.apiOwnSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(s.ID, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	app.events.Notify(models.EventSnippetDeleted, s)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiOwnSnippet is the API equivalent of ownSnippet. It fetches the snippet identified by
+// the ":id" URL parameter, checking that it was created by the authenticated user.
+func (app *application) apiOwnSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, err := app.findSnippet(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return nil, false
+	}
+
+	if s.UserID == 0 || s.UserID != app.authenticatedUserID(r) {
+		app.apiClientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// readJSON decodes the JSON request body into dst. Bodies over 1MB, with unknown fields, or
+// with anything after the JSON value are rejected. If the body can't be decoded, a 400 Bad
+// Request response is sent and readJSON returns false.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body must contain a single JSON value")
+	}
+	if err != nil {
+		app.writeJSON(w, http.StatusBadRequest, &apiError{
+			Error: fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err),
+		})
+		return false
+	}
+
+	return true
+}
+
+// apiTokenInput is the JSON request body used to create an API token. Expires is the number
+// of days until the token expires, or 0 for a token which never expires.
+type apiTokenInput struct {
+	Name    string `json:"name"`
+	Expires int    `json:"expires"`
+}
+
+// apiToken is the JSON response body holding a newly created API token.
+type apiToken struct {
+	Token   string     `json:"token"`
+	Name    string     `json:"name"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// apiCreateToken creates a personal API token, so that command-line clients can log in
+// without handling the session cookie and CSRF token of the login form. Tokens can only be
+// created with the user's email address and password, so that a leaked token can't be used
+// to create more tokens.
+func (app *application) apiCreateToken(w http.ResponseWriter, r *http.Request) {
+	var in apiTokenInput
+	if !app.readJSON(w, r, &in) {
+		return
+	}
+
+	// Validate the input with the same rules as the token settings page.
+	values := url.Values{}
+	values.Set("name", in.Name)
+	values.Set("expires", "never")
+	if in.Expires != 0 {
+		values.Set("expires", strconv.Itoa(in.Expires))
+	}
+	form := forms.NewForm(values)
+	validateTokenForm(form)
+	if !form.Valid() {
+		app.apiValidationError(w, form)
+		return
+	}
+
+	out := &apiToken{Name: in.Name}
+	var expires time.Time
+	if in.Expires != 0 {
+		expires = time.Now().UTC().AddDate(0, 0, in.Expires)
+		out.Expires = &expires
+	}
+
+	var err error
+	out.Token, err = app.tokens.Insert(app.authenticatedUserID(r), in.Name, expires)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, out)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+	"github.com/DataDavD/snippetbox/pkg/models/mock"
+)
+
+// basicAuth returns a request setup function which adds HTTP Basic authentication
+// credentials to the request.
+func basicAuth(email, password string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.SetBasicAuth(email, password)
+	}
+}
+
+// bearerToken returns a request setup function which adds a personal API token to the
+// request.
+func bearerToken(token string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// TestAPIListSnippets tests that the API lists public snippets as JSON.
+func TestAPIListSnippets(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantCode  int
+		wantCount int
+	}{
+		{"First page", "/api/v1/snippets", http.StatusOK, 1},
+		{"Empty page", "/api/v1/snippets?page=2", http.StatusOK, 0},
+		{"Invalid page", "/api/v1/snippets?page=0", http.StatusBadRequest, 0},
+		{"Invalid per_page", "/api/v1/snippets?per_page=1000", http.StatusBadRequest, 0},
+		{"Invalid cursor", "/api/v1/snippets?page=2&after=foo", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if ct := header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("want Content-Type %q; got %q", "application/json", ct)
+			}
+
+			if code != http.StatusOK {
+				return
+			}
+
+			var list apiSnippetList
+			if err := json.Unmarshal(body, &list); err != nil {
+				t.Fatal(err)
+			}
+			if len(list.Snippets) != tt.wantCount {
+				t.Errorf("want %d snippets; got %d", tt.wantCount, len(list.Snippets))
+			}
+			if list.Total != 1 {
+				t.Errorf("want total %d; got %d", 1, list.Total)
+			}
+		})
+	}
+}
+
+// TestAPIShowSnippet tests that the API sends snippets as JSON, with the same visibility
+// rules as the HTML pages, and JSON error bodies.
+func TestAPIShowSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		setup    func(*http.Request)
+		wantCode int
+		wantBody string
+	}{
+		{"Valid ID", "/api/v1/snippets/1", nil, http.StatusOK, `"title": "An old silent pond"`},
+		{"Non-existent ID", "/api/v1/snippets/2", nil, http.StatusNotFound,
+			`"error": "Not Found"`},
+		{"String ID", "/api/v1/snippets/foo", nil, http.StatusNotFound, `"error": "Not Found"`},
+		{"Private snippet", "/api/v1/snippets/6", nil, http.StatusNotFound,
+			`"error": "Not Found"`},
+		{"Own private snippet", "/api/v1/snippets/6", bearerToken(mock.MockToken), http.StatusOK,
+			`"title": "Alice's private snippet"`},
+		{"Invalid credentials", "/api/v1/snippets/1", bearerToken("sbx_wrong"),
+			http.StatusUnauthorized, `"error": "Unauthorized"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.do(t, http.MethodGet, tt.urlPath, nil, tt.setup)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if ct := header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("want Content-Type %q; got %q", "application/json", ct)
+			}
+
+			if !bytes.Contains(body, []byte(tt.wantBody)) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestAPIWriteSnippets tests that snippets can be created, updated and deleted through the
+// API by their author, using the same validation rules as the HTML forms.
+func TestAPIWriteSnippets(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	alice := bearerToken(mock.MockToken)
+	valid := `{"title": "Title", "content": "Content", "expires": 7, "tags": ["k8s"]}`
+
+	tests := []struct {
+		name         string
+		method       string
+		urlPath      string
+		body         string
+		setup        func(*http.Request)
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"Create", http.MethodPost, "/api/v1/snippets", valid, alice, http.StatusCreated,
+			"/api/v1/snippets/1", `"id": 1`},
+		{"Create unauthenticated", http.MethodPost, "/api/v1/snippets", valid, nil,
+			http.StatusUnauthorized, "", `"error": "Unauthorized"`},
+		{"Create invalid", http.MethodPost, "/api/v1/snippets",
+			`{"title": "", "content": "Content", "expires": 2}`, alice,
+			http.StatusUnprocessableEntity, "", `"title": [`},
+		{"Create invalid visibility", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires": 7, "visibility": "secret"}`,
+			alice, http.StatusUnprocessableEntity, "", `"visibility": [`},
+		{"Create burn after reading", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires": 7, "max_views": 1}`, alice,
+			http.StatusCreated, "/api/v1/snippets/1", `"id": 1`},
+		{"Create with negative max views", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires": 7, "max_views": -1}`, alice,
+			http.StatusUnprocessableEntity, "", `"max_views": [`},
+		{"Create with too many max views", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires": 7, "max_views": 101}`, alice,
+			http.StatusUnprocessableEntity, "", `"max_views": [`},
+		{"Create with password", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires": 7, "password": "correct horse"}`,
+			alice, http.StatusCreated, "/api/v1/snippets/1", `"id": 1`},
+		{"Create with short password", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires": 7, "password": "horse"}`, alice,
+			http.StatusUnprocessableEntity, "", `"password": [`},
+		{"Create encrypted", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "q83vEjRWeJCrze8SNFZ4kKvN7xI0VniQ", "expires": 7, ` +
+				`"encrypted": true}`,
+			alice, http.StatusCreated, "/api/v1/snippets/1", `"id": 1`},
+		{"Create encrypted without ciphertext", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires": 7, "encrypted": true}`, alice,
+			http.StatusUnprocessableEntity, "", `"content": [`},
+		{"Create never expiring", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "never_expires": true}`, alice,
+			http.StatusCreated, "/api/v1/snippets/1", `"id": 1`},
+		{"Create with expiry time", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires_at": "` +
+				time.Now().AddDate(0, 1, 0).Format(time.RFC3339) + `"}`, alice,
+			http.StatusCreated, "/api/v1/snippets/1", `"id": 1`},
+		{"Create with past expiry time", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "content": "Content", "expires_at": "2021-01-01T00:00:00Z"}`,
+			alice, http.StatusUnprocessableEntity, "", `"expires_at": [`},
+		{"Create malformed JSON", http.MethodPost, "/api/v1/snippets", `{"title": `, alice,
+			http.StatusBadRequest, "", `"error": "Bad Request: `},
+		{"Create unknown field", http.MethodPost, "/api/v1/snippets",
+			`{"title": "Title", "author": "Mallory"}`, alice, http.StatusBadRequest, "",
+			`unknown field`},
+		{"Update", http.MethodPut, "/api/v1/snippets/1", valid, alice, http.StatusOK, "",
+			`"id": 1`},
+		{"Update other user's snippet", http.MethodPut, "/api/v1/snippets/3", valid, alice,
+			http.StatusForbidden, "", `"error": "Forbidden"`},
+		{"Update non-existent snippet", http.MethodPut, "/api/v1/snippets/2", valid, alice,
+			http.StatusNotFound, "", `"error": "Not Found"`},
+		{"Update unauthenticated", http.MethodPut, "/api/v1/snippets/1", valid, nil,
+			http.StatusUnauthorized, "", `"error": "Unauthorized"`},
+		{"Delete", http.MethodDelete, "/api/v1/snippets/1", "", alice, http.StatusNoContent,
+			"", ""},
+		{"Delete other user's snippet", http.MethodDelete, "/api/v1/snippets/3", "", alice,
+			http.StatusForbidden, "", `"error": "Forbidden"`},
+		{"Delete private snippet", http.MethodDelete, "/api/v1/snippets/4", "", alice,
+			http.StatusNotFound, "", `"error": "Not Found"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.do(t, tt.method, tt.urlPath, strings.NewReader(tt.body),
+				tt.setup)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want Location %q; got %q", tt.wantLocation, loc)
+			}
+
+			if !bytes.Contains(body, []byte(tt.wantBody)) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestAPITokenAuth tests that API requests can be authenticated with a personal API token,
+// and that requests with an invalid token are rejected rather than treated as anonymous.
+func TestAPITokenAuth(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	valid := `{"title": "Title", "content": "Content", "expires": 7}`
+
+	tests := []struct {
+		name      string
+		method    string
+		urlPath   string
+		body      string
+		setup     func(*http.Request)
+		wantCode  int
+		wantChall string
+	}{
+		{"Valid token", http.MethodPost, "/api/v1/snippets", valid, bearerToken(mock.MockToken),
+			http.StatusCreated, ""},
+		{"Valid token private snippet", http.MethodGet, "/api/v1/snippets/6", "",
+			bearerToken(mock.MockToken), http.StatusOK, ""},
+		{"Invalid token", http.MethodPost, "/api/v1/snippets", valid, bearerToken("sbx_wrong"),
+			http.StatusUnauthorized, "Bearer"},
+		{"Invalid token public snippet", http.MethodGet, "/api/v1/snippets/1", "",
+			bearerToken("sbx_wrong"), http.StatusUnauthorized, "Bearer"},
+		{"No credentials", http.MethodPost, "/api/v1/snippets", valid, nil,
+			http.StatusUnauthorized, "Bearer"},
+		{"Create token with password", http.MethodPost, "/api/v1/tokens", `{"name": "ci"}`,
+			basicAuth("alice@example.com", "validPa$$word"), http.StatusCreated, ""},
+		{"Create token with token", http.MethodPost, "/api/v1/tokens", `{"name": "ci"}`,
+			bearerToken(mock.MockToken), http.StatusUnauthorized, "Basic"},
+		{"Create token without credentials", http.MethodPost, "/api/v1/tokens",
+			`{"name": "ci"}`, nil, http.StatusUnauthorized, "Basic"},
+		{"Create token with wrong password", http.MethodPost, "/api/v1/tokens",
+			`{"name": "ci"}`, basicAuth("bob@example.com", "wrong"), http.StatusUnauthorized,
+			"Basic"},
+		{"Password", http.MethodPost, "/api/v1/snippets", valid,
+			basicAuth("alice@example.com", "validPa$$word"), http.StatusUnauthorized, "Bearer"},
+		{"Password public snippet", http.MethodGet, "/api/v1/snippets/1", "",
+			basicAuth("alice@example.com", "validPa$$word"), http.StatusUnauthorized, "Bearer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, _ := ts.do(t, tt.method, tt.urlPath, strings.NewReader(tt.body),
+				tt.setup)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if chall := header.Get("WWW-Authenticate"); !strings.HasPrefix(chall, tt.wantChall) {
+				t.Errorf("want WWW-Authenticate to start with %q; got %q", tt.wantChall, chall)
+			}
+		})
+	}
+}
+
+// TestAPILoginThrottling tests that guessing passwords through the API is refused after too
+// many wrong guesses, even if the next guess is right.
+func TestAPILoginThrottling(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	for i := 1; i <= apiLoginClientAttempts+1; i++ {
+		setup := basicAuth("bob@example.com", "wrong")
+		want := http.StatusUnauthorized
+		if i > apiLoginClientAttempts {
+			setup = basicAuth("alice@example.com", "validPa$$word")
+			want = http.StatusTooManyRequests
+		}
+
+		body := strings.NewReader(`{"name": "ci"}`)
+		code, _, _ := ts.do(t, http.MethodPost, "/api/v1/tokens", body, setup)
+		if code != want {
+			t.Fatalf("attempt %d: want %d; got %d", i, want, code)
+		}
+	}
+}
+
+// TestAPISnippetJSON tests the JSON encoding of snippets used by the API.
+func TestAPISnippetJSON(t *testing.T) {
+	t.Parallel()
+
+	js, err := json.Marshal(&models.Snippet{ID: 1, Title: "Title", Tags: []string{"k8s"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"id":1`, `"title":"Title"`, `"tags":["k8s"]`,
+		`"user_id":0`, `"visibility":""`} {
+		if !strings.Contains(string(js), want) {
+			t.Errorf("want %s to contain %s", js, want)
+		}
+	}
+}
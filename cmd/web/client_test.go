@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/DataDavD/snippetbox/pkg/client"
+	"github.com/DataDavD/snippetbox/pkg/models/mock"
+)
+
+// newTestClient returns an API client for the test server, which trusts the test server's
+// TLS certificate.
+func newTestClient(ts *testServer, token string) *client.Client {
+	c := client.New(ts.URL, token)
+	c.HTTPClient = ts.Client()
+	return c
+}
+
+// TestClient tests the API client used by snippetctl against the application, wired up with
+// the mock models.
+func TestClient(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Login", func(t *testing.T) {
+		c := newTestClient(ts, "")
+		tok, err := c.Login("alice@example.com", "validPa$$word", "snippetctl laptop", 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Token != mock.MockToken || c.Token != mock.MockToken {
+			t.Errorf("want token %q; got %q", mock.MockToken, tok.Token)
+		}
+		if tok.Expires == nil {
+			t.Error("want an expiry time; got nil")
+		}
+	})
+
+	t.Run("Login with wrong password", func(t *testing.T) {
+		_, err := newTestClient(ts, "").Login("bob@example.com", "wrong", "laptop", 0)
+		wantStatus(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("Login with invalid expiry", func(t *testing.T) {
+		_, err := newTestClient(ts, "").Login("alice@example.com", "validPa$$word", "laptop", 7)
+		wantStatus(t, err, http.StatusUnprocessableEntity)
+
+		var e *client.Error
+		if errors.As(err, &e) && len(e.Fields["expires"]) == 0 {
+			t.Errorf("want a field error for expires; got %v", e.Fields)
+		}
+	})
+
+	c := newTestClient(ts, mock.MockToken)
+
+	t.Run("Create", func(t *testing.T) {
+		s, err := c.Create(&client.SnippetInput{Title: "Title", Content: "Content", Expires: 7,
+			Tags: []string{"go"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Slug != "anOldSilentPond0000001" {
+			t.Errorf("want slug %q; got %q", "anOldSilentPond0000001", s.Slug)
+		}
+	})
+
+	t.Run("Create never expiring", func(t *testing.T) {
+		_, err := c.Create(&client.SnippetInput{Title: "Title", Content: "Content",
+			NeverExpires: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Create invalid", func(t *testing.T) {
+		_, err := c.Create(&client.SnippetInput{Title: "Title", Content: "Content", Expires: 1000})
+		wantStatus(t, err, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Create unauthenticated", func(t *testing.T) {
+		_, err := newTestClient(ts, "").Create(&client.SnippetInput{Title: "Title",
+			Content: "Content", Expires: 7})
+		wantStatus(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		s, err := c.Get(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Title != "An old silent pond" {
+			t.Errorf("want title %q; got %q", "An old silent pond", s.Title)
+		}
+	})
+
+	t.Run("Get own private snippet", func(t *testing.T) {
+		if _, err := c.Get(6); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Get other user's private snippet", func(t *testing.T) {
+		_, err := c.Get(4)
+		wantStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		list, err := c.List(1, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Snippets) != 1 || list.Total != 1 {
+			t.Errorf("want 1 snippet; got %d of %d", len(list.Snippets), list.Total)
+		}
+	})
+}
+
+// wantStatus checks that err is an error response from the server with the given status.
+func wantStatus(t *testing.T, err error, status int) {
+	t.Helper()
+
+	var e *client.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("want a *client.Error; got %v", err)
+	}
+	if e.StatusCode != status {
+		t.Errorf("want status %d; got %d (%s)", status, e.StatusCode, e)
+	}
+}
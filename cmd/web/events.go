@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// notifySnippet sends a webhook event about the snippet with the given id. The snippet is
+// fetched again, so that the event holds every field of the snippet as it was saved, like
+// its author, creation time and tags. Webhooks are best effort, so errors are logged
+// rather than failing the request.
+func (app *application) notifySnippet(event string, id int) {
+	s, err := app.snippets.Get(id)
+	if err != nil {
+		app.errorLog.Printf("sending %s event for snippet %d: %s", event, id, err)
+		return
+	}
+	app.events.Notify(event, s)
+}
+
+// expiredCheckpoint is the name of the checkpoint recording the time up to which
+// snippet.expired events have been sent.
+const expiredCheckpoint = "snippet.expired"
+
+// expiryWatcher sends a webhook event for each snippet as it expires, checking every
+// interval. It records how far it's got as a checkpoint, so that snippets which expire while
+// the application is down get their events when it starts again. The first check is made
+// as soon as it starts, to catch up.
+type expiryWatcher struct {
+	app      *application
+	clock    clock
+	interval time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newExpiryWatcher(app *application, interval time.Duration) *expiryWatcher {
+	return &expiryWatcher{
+		app:      app,
+		clock:    realClock{},
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts watching in the background.
+func (w *expiryWatcher) Start() {
+	go w.run()
+}
+
+// Stop stops the watcher, waiting for a check in progress to finish.
+func (w *expiryWatcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *expiryWatcher) run() {
+	defer close(w.done)
+
+	// Without a checkpoint, this is the first time the watcher has run, so there's nothing
+	// to catch up on.
+	last, err := w.app.checkpoints.Get(expiredCheckpoint)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			w.app.errorLog.Printf("finding expired snippets: %s", err)
+		}
+		last = w.clock.Now()
+	}
+
+	for {
+		// Checkpoints are stored to the second, so check up to a whole second; otherwise
+		// rounding the checkpoint could skip snippets expiring in the same second.
+		now := w.clock.Now().UTC().Truncate(time.Second)
+		if now.After(last) && w.app.notifyExpired(last, now) {
+			last = now
+			if err := w.app.checkpoints.Set(expiredCheckpoint, now); err != nil {
+				w.app.errorLog.Printf("recording expired snippets checkpoint: %s", err)
+			}
+		}
+
+		select {
+		case <-w.clock.After(w.interval):
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// notifyExpired sends a webhook event for each snippet which expired after from and at or
+// before to. It reports whether the expired snippets could be found; if not, the error is
+// logged, and they should be looked for again.
+func (app *application) notifyExpired(from, to time.Time) bool {
+	expired, err := app.snippets.Expired(from, to)
+	if err != nil {
+		app.errorLog.Printf("finding expired snippets: %s", err)
+		return false
+	}
+
+	for _, s := range expired {
+		app.events.Notify(models.EventSnippetExpired, s)
+	}
+	return true
+}
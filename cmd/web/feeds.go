@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// feedLength is the number of snippets in a user's feed. The site-wide feed has the same
+// snippets as the home page.
+const feedLength = 20
+
+// feed is a list of snippets to publish as an Atom or RSS feed, independent of the format.
+type feed struct {
+	Title string
+	// Path is the path of the page the feed is about, and Self the path of the feed itself.
+	Path     string
+	Self     string
+	Snippets []*models.Snippet
+}
+
+// updated returns the time the feed was last updated: the latest time one of its snippets
+// was created or edited. An empty feed has the zero time, so that its ETag and Last-Modified
+// header don't change every time it's fetched.
+func (f *feed) updated() time.Time {
+	var t time.Time
+	for _, s := range f.Snippets {
+		if s.Updated.After(t) {
+			t = s.Updated
+		}
+	}
+	return t.UTC()
+}
+
+// atomFeed serves the latest snippets as an Atom feed.
+func (app *application) atomFeed(w http.ResponseWriter, r *http.Request) {
+	f, ok := app.latestFeed(w, r)
+	if !ok {
+		return
+	}
+	app.writeFeed(w, r, "application/atom+xml; charset=utf-8", newAtomFeed(app.baseURL, f))
+}
+
+// rssFeed serves the latest snippets as an RSS 2.0 feed.
+func (app *application) rssFeed(w http.ResponseWriter, r *http.Request) {
+	f, ok := app.latestFeed(w, r)
+	if !ok {
+		return
+	}
+	app.writeFeed(w, r, "application/rss+xml; charset=utf-8", newRSSFeed(app.baseURL, f))
+}
+
+// userAtomFeed serves the latest snippets of the user given by the ":id" URL parameter as an
+// Atom feed.
+func (app *application) userAtomFeed(w http.ResponseWriter, r *http.Request) {
+	f, ok := app.userFeed(w, r)
+	if !ok {
+		return
+	}
+	app.writeFeed(w, r, "application/atom+xml; charset=utf-8", newAtomFeed(app.baseURL, f))
+}
+
+// userRSSFeed serves the latest snippets of the user given by the ":id" URL parameter as an
+// RSS 2.0 feed.
+func (app *application) userRSSFeed(w http.ResponseWriter, r *http.Request) {
+	f, ok := app.userFeed(w, r)
+	if !ok {
+		return
+	}
+	app.writeFeed(w, r, "application/rss+xml; charset=utf-8", newRSSFeed(app.baseURL, f))
+}
+
+// latestFeed returns the feed of the latest snippets, or sends an error response and returns
+// false.
+func (app *application) latestFeed(w http.ResponseWriter, r *http.Request) (*feed, bool) {
+	s, err := app.snippets.Latest()
+	if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+	return &feed{Title: "Latest snippets - Snippetbox", Path: "/", Self: r.URL.Path, Snippets: s},
+		true
+}
+
+// userFeed returns the feed of the latest snippets of the user given by the ":id" URL
+// parameter, or sends an error response and returns false. Only listed snippets appear in
+// the feed, so it never reveals unlisted or private snippets. Users don't have a page of
+// their own, so the feed links to the home page.
+func (app *application) userFeed(w http.ResponseWriter, r *http.Request) (*feed, bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+
+	user, err := app.users.Get(id)
+	if errors.Is(err, models.ErrNoRecord) {
+		app.notFound(w)
+		return nil, false
+	} else if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	s, err := app.snippets.ByUser(id, feedLength)
+	if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	return &feed{
+		Title:    fmt.Sprintf("Snippets by %s - Snippetbox", user.Name),
+		Path:     "/",
+		Self:     r.URL.Path,
+		Snippets: s,
+	}, true
+}
+
+// writeFeed encodes v as an XML document and sends it with the given content type. The ETag
+// is a hash of the document, so feed readers polling with If-None-Match get a 304 Not
+// Modified response until a snippet is added or changed. http.ServeContent takes care of the
+// conditional request headers, as well as HEAD requests.
+func (app *application) writeFeed(w http.ResponseWriter, r *http.Request, contentType string,
+	v interface{ updated() time.Time }) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, r, "", v.updated(), bytes.NewReader(buf.Bytes()))
+}
+
+// atomDocument is an Atom feed, as described by RFC 4287. Text is escaped by encoding/xml,
+// so snippet titles and content are sent as they are.
+type atomDocument struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+
+	modified time.Time
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// atomEntry is a snippet in an Atom feed. Snippets created before authors were recorded
+// have no author, and Atom requires one, so they're credited to "Anonymous".
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Link      atomLink   `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Author    atomPerson `xml:"author"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (d *atomDocument) updated() time.Time {
+	return d.modified
+}
+
+// newAtomFeed returns the Atom document for f. Each entry's ID is the snippet's canonical
+// URL, which never changes, since slugs are permanent.
+func newAtomFeed(base string, f *feed) *atomDocument {
+	updated := f.updated()
+	d := &atomDocument{
+		Title:   f.Title,
+		ID:      base + f.Self,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + f.Self},
+			{Rel: "alternate", Type: "text/html", Href: base + f.Path},
+		},
+		modified: updated,
+	}
+
+	for _, s := range f.Snippets {
+		url := base + "/s/" + s.Slug
+		author := s.Author
+		if author == "" {
+			author = "Anonymous"
+		}
+		d.Entries = append(d.Entries, atomEntry{
+			Title:     s.Title,
+			ID:        url,
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: url},
+			Published: s.Created.UTC().Format(time.RFC3339),
+			Updated:   s.Updated.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: author},
+			Content:   atomText{Type: "text", Body: s.Content},
+		})
+	}
+
+	return d
+}
+
+// rssDocument is an RSS 2.0 feed. The atom:link element lets feed readers find the feed's
+// own URL, as recommended by the RSS Advisory Board.
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+
+	modified time.Time
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      rssLink   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (d *rssDocument) updated() time.Time {
+	return d.modified
+}
+
+// newRSSFeed returns the RSS document for f. RSS dates use the RFC 822 format, and an empty
+// feed has no lastBuildDate. Feed readers render an item's description as HTML, and RSS has
+// no way to say that it's plain text, so the content is escaped and sent preformatted.
+func newRSSFeed(base string, f *feed) *rssDocument {
+	updated := f.updated()
+	d := &rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        base + f.Path,
+			Description: f.Title,
+			AtomLink:    rssLink{Href: base + f.Self, Rel: "self", Type: "application/rss+xml"},
+		},
+		modified: updated,
+	}
+	if !updated.IsZero() {
+		d.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, s := range f.Snippets {
+		url := base + "/s/" + s.Slug
+		d.Channel.Items = append(d.Channel.Items, rssItem{
+			Title:       s.Title,
+			Link:        url,
+			GUID:        rssGUID{IsPermaLink: true, Value: url},
+			PubDate:     s.Created.UTC().Format(time.RFC1123Z),
+			Description: "<pre>" + html.EscapeString(s.Content) + "</pre>",
+		})
+	}
+
+	return d
+}
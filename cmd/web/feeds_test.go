@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+func TestFeeds(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantContentType string
+		wantBody        []string
+	}{
+		{"Atom", "/feed.atom", http.StatusOK, "application/atom+xml; charset=utf-8", []string{
+			`<feed xmlns="http://www.w3.org/2005/Atom">`,
+			"<title>Latest snippets - Snippetbox</title>",
+			"<title>An old silent pond</title>",
+			"/s/anOldSilentPond0000001</id>",
+			"<name>Alice</name>",
+		}},
+		{"RSS", "/feed.rss", http.StatusOK, "application/rss+xml; charset=utf-8", []string{
+			`<rss version="2.0"`,
+			"<title>An old silent pond</title>",
+			`<guid isPermaLink="true">`,
+		}},
+		// Users have no page of their own, so their feeds link to the home page.
+		{"User Atom", "/user/1/feed.atom", http.StatusOK, "application/atom+xml; charset=utf-8",
+			[]string{"<title>Snippets by Alice - Snippetbox</title>", "<title>An old silent pond</title>",
+				`type="text/html" href="https://snippetbox.example.com/"></link>`}},
+		{"User RSS", "/user/1/feed.rss", http.StatusOK, "application/rss+xml; charset=utf-8",
+			[]string{"<title>Snippets by Alice - Snippetbox</title>", "<title>An old silent pond</title>",
+				"<link>https://snippetbox.example.com/</link>"}},
+		{"Non-existent user", "/user/3/feed.atom", http.StatusNotFound, "", nil},
+		{"Invalid user ID", "/user/foo/feed.rss", http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Fatalf("want %d; got %d", tt.wantCode, code)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			if got := header.Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("want Content-Type %q; got %q", tt.wantContentType, got)
+			}
+			if !strings.HasPrefix(string(body), xml.Header) {
+				t.Errorf("want body to start with the XML declaration; got %q", body[:40])
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+
+			etag := header.Get("ETag")
+			if etag == "" {
+				t.Fatal("want an ETag; got none")
+			}
+
+			// Feed readers polling with the ETag are told that the feed hasn't changed.
+			code, _, body = ts.do(t, http.MethodGet, tt.urlPath, nil, func(r *http.Request) {
+				r.Header.Set("If-None-Match", etag)
+			})
+			if code != http.StatusNotModified || len(body) != 0 {
+				t.Errorf("want %d with no body; got %d with %d bytes", http.StatusNotModified,
+					code, len(body))
+			}
+		})
+	}
+}
+
+// TestForgedHost tests that absolute URLs are built from the configured base URL, and never
+// from the Host header, which the client controls.
+func TestForgedHost(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	for _, urlPath := range []string{"/feed.atom", "/feed.rss", "/user/1/feed.atom",
+		"/snippet/1/embed.js"} {
+		code, _, body := ts.do(t, http.MethodGet, urlPath, nil, func(r *http.Request) {
+			r.Host = "evil.example.com"
+		})
+		if code != http.StatusOK {
+			t.Fatalf("%s: want %d; got %d", urlPath, http.StatusOK, code)
+		}
+		if strings.Contains(string(body), "evil.example.com") ||
+			!strings.Contains(string(body), "https://snippetbox.example.com/") {
+			t.Errorf("%s: want URLs on the configured base URL; got %q", urlPath, body)
+		}
+	}
+}
+
+// TestFeedEscaping tests that titles and content are escaped, so that they survive a round
+// trip through an XML parser unchanged. RSS descriptions are HTML, so content is escaped
+// again for them, and only ever shows as text.
+func TestFeedEscaping(t *testing.T) {
+	created := time.Date(2021, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	f := &feed{Title: "Latest", Path: "/", Self: "/feed.atom", Snippets: []*models.Snippet{{
+		Title:   `<script>alert("hi")</script> & more`,
+		Content: "if a < b && b > c {\n\t]]> </content>\n}",
+		Created: created,
+		Updated: created,
+		Slug:    "escapingSnippet0000001",
+	}}}
+
+	var atom struct {
+		Updated string `xml:"updated"`
+		Entries []struct {
+			Title     string `xml:"title"`
+			ID        string `xml:"id"`
+			Author    string `xml:"author>name"`
+			Content   string `xml:"content"`
+			Published string `xml:"published"`
+			Updated   string `xml:"updated"`
+		} `xml:"entry"`
+	}
+	b, err := xml.Marshal(newAtomFeed("https://example.com", f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(b, &atom); err != nil {
+		t.Fatal(err)
+	}
+
+	if atom.Updated != "2021-03-04T04:06:07Z" {
+		t.Errorf("want updated %q; got %q", "2021-03-04T04:06:07Z", atom.Updated)
+	}
+	if len(atom.Entries) != 1 {
+		t.Fatalf("want 1 entry; got %d", len(atom.Entries))
+	}
+	e := atom.Entries[0]
+	if e.Title != f.Snippets[0].Title || e.Content != f.Snippets[0].Content {
+		t.Errorf("want title %q and content %q; got %q and %q", f.Snippets[0].Title,
+			f.Snippets[0].Content, e.Title, e.Content)
+	}
+	if e.ID != "https://example.com/s/escapingSnippet0000001" {
+		t.Errorf("want ID %q; got %q", "https://example.com/s/escapingSnippet0000001", e.ID)
+	}
+	if e.Author != "Anonymous" {
+		t.Errorf("want author %q; got %q", "Anonymous", e.Author)
+	}
+
+	var rss struct {
+		LastBuildDate string `xml:"channel>lastBuildDate"`
+		Items         []struct {
+			Title       string `xml:"title"`
+			PubDate     string `xml:"pubDate"`
+			Description string `xml:"description"`
+		} `xml:"channel>item"`
+	}
+	b, err = xml.Marshal(newRSSFeed("https://example.com", f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(b, &rss); err != nil {
+		t.Fatal(err)
+	}
+
+	if rss.LastBuildDate != "Thu, 04 Mar 2021 04:06:07 +0000" {
+		t.Errorf("want lastBuildDate %q; got %q", "Thu, 04 Mar 2021 04:06:07 +0000",
+			rss.LastBuildDate)
+	}
+	wantDescription := "<pre>if a &lt; b &amp;&amp; b &gt; c {\n\t]]&gt; &lt;/content&gt;\n}</pre>"
+	if len(rss.Items) != 1 || rss.Items[0].Title != f.Snippets[0].Title ||
+		rss.Items[0].Description != wantDescription {
+		t.Errorf("want the snippet's title and escaped content; got %+v", rss.Items)
+	}
+}
+
+// TestFeedUpdated tests that edited snippets show as updated, and that the feed's own update
+// time is the latest time any of its snippets was created or edited.
+func TestFeedUpdated(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	edited := created.Add(48 * time.Hour)
+	f := &feed{Title: "Latest", Path: "/", Self: "/feed.atom", Snippets: []*models.Snippet{
+		{Title: "Newest", Created: created.Add(time.Hour), Updated: created.Add(time.Hour),
+			Slug: "newestSnippet000000001"},
+		{Title: "Edited", Created: created, Updated: edited, Slug: "editedSnippet000000001"},
+	}}
+
+	var atom struct {
+		Updated string `xml:"updated"`
+		Entries []struct {
+			Published string `xml:"published"`
+			Updated   string `xml:"updated"`
+		} `xml:"entry"`
+	}
+	b, err := xml.Marshal(newAtomFeed("https://example.com", f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(b, &atom); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "2021-03-06T05:06:07Z"; atom.Updated != want {
+		t.Errorf("want feed updated %q; got %q", want, atom.Updated)
+	}
+	if len(atom.Entries) != 2 {
+		t.Fatalf("want 2 entries; got %d", len(atom.Entries))
+	}
+	if e := atom.Entries[1]; e.Published != "2021-03-04T05:06:07Z" ||
+		e.Updated != "2021-03-06T05:06:07Z" {
+		t.Errorf("want the edited entry published %q and updated %q; got %q and %q",
+			"2021-03-04T05:06:07Z", "2021-03-06T05:06:07Z", e.Published, e.Updated)
+	}
+	if !f.updated().Equal(edited) {
+		t.Errorf("want Last-Modified %v; got %v", edited, f.updated())
+	}
+}
@@ -1,14 +1,25 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	// "html/template"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/DataDavD/snippetbox/pkg/diff"
 	"github.com/DataDavD/snippetbox/pkg/forms"
 	"github.com/DataDavD/snippetbox/pkg/models"
+	"github.com/DataDavD/snippetbox/pkg/webhook"
 )
 
 func (app *application) ping(w http.ResponseWriter, r *http.Request) {
@@ -18,47 +29,611 @@ func (app *application) ping(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// openAPISpec serves the OpenAPI document describing every route. Integrators' tools, like
+// API explorers and client generators, may run on other origins, so any origin is allowed
+// to fetch it.
+func (app *application) openAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	http.ServeFile(w, r, "./ui/static/openapi.json")
+}
+
 // Define a home handler func which writes a byte slice containing
 // "Hello from Snippetbox" as resp body.
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	// Because Pat matches the "/" path exactly, we can now remove the manual check
 	// of r.URL.Path != "/" from this handler.
 
-	s, err := app.snippets.Latest()
+	// The latest snippets can be filtered by tag with the "tag" query string parameter.
+	tag := strings.ToLower(r.URL.Query().Get("tag"))
+
+	var s []*models.Snippet
+	var err error
+	if tag != "" {
+		s, err = app.snippets.Tagged(tag, 10)
+	} else {
+		s, err = app.snippets.Latest()
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tags, err := app.snippets.Tags()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Scripts can ask for the latest snippets as JSON, or as plain text with one snippet per
+	// line.
+	text := "There's nothing to see here yet!\n"
+	if len(s) > 0 {
+		var b strings.Builder
+		for _, snippet := range s {
+			fmt.Fprintf(&b, "/s/%s\t%s\n", snippet.Slug, snippet.Title)
+		}
+		text = b.String()
+	}
+
+	// Encode an empty list as [] rather than null.
+	if s == nil {
+		s = []*models.Snippet{}
+	}
+
+	app.respond(w, r, &representations{
+		Page: "home.page.gohtml",
+		Data: &templateData{Snippets: s, Tag: tag, Tags: tags},
+		JSON: &latestSnippets{Snippets: s, Tag: tag},
+		Text: text,
+	})
+}
+
+// latestSnippets is the JSON representation of the home page.
+type latestSnippets struct {
+	Snippets []*models.Snippet `json:"snippets"`
+	Tag      string            `json:"tag,omitempty"`
+}
+
+// tagSnippets lists the most recent snippets with the tag given by the ":name" URL
+// parameter.
+func (app *application) tagSnippets(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(r.URL.Query().Get(":name"))
+	if !forms.TagRX.MatchString(tag) {
+		app.notFound(w)
+		return
+	}
+
+	s, err := app.snippets.Tagged(tag, 100)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "tag.page.gohtml", &templateData{Snippets: s, Tag: tag})
+}
+
+// browseSnippets lists all unexpired snippets, newest first, a page at a time. The page
+// number and size are set with the "page" and "per_page" query string parameters. The
+// previous and next links also carry a "before" or "after" cursor, so that moving between
+// neighbouring pages seeks straight to the right position rather than counting through all
+// the snippets in front of it.
+func (app *application) browseSnippets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	p := &pagination{Page: 1, PerPage: 20}
+	var err error
+	if v := query.Get("page"); v != "" {
+		if p.Page, err = strconv.Atoi(v); err != nil || p.Page < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("per_page"); v != "" {
+		if p.PerPage, err = strconv.Atoi(v); err != nil || p.PerPage < 1 || p.PerPage > 100 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var cursor *models.Cursor
+	if v := query.Get("after"); v != "" {
+		cursor, err = parseCursor(v, false)
+	} else if v := query.Get("before"); v != "" {
+		cursor, err = parseCursor(v, true)
+	}
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	s, total, err := app.snippets.Page(cursor, (p.Page-1)*p.PerPage, p.PerPage)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	p.Total = total
+	p.TotalPages = (total + p.PerPage - 1) / p.PerPage
+	if len(s) > 0 {
+		if p.Page > 1 {
+			p.PrevURL = fmt.Sprintf("/snippets?page=%d&per_page=%d&before=%s", p.Page-1,
+				p.PerPage, formatCursor(s[0]))
+		}
+		if p.Page < p.TotalPages {
+			p.NextURL = fmt.Sprintf("/snippets?page=%d&per_page=%d&after=%s", p.Page+1,
+				p.PerPage, formatCursor(s[len(s)-1]))
+		}
+	}
+
+	app.render(w, r, "snippets.page.gohtml", &templateData{Snippets: s, Pagination: p})
+}
+
+// searchSnippets finds snippets matching the "q" query string parameter, most relevant
+// first. Results are shown a page at a time, with the page number set by the "page"
+// parameter.
+func (app *application) searchSnippets(w http.ResponseWriter, r *http.Request) {
+	const perPage = 20
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	p := &pagination{Page: 1, PerPage: perPage}
+	if v := r.URL.Query().Get("page"); v != "" {
+		var err error
+		if p.Page, err = strconv.Atoi(v); err != nil || p.Page < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Without a query there's nothing to search for, so just show the search form.
+	if q == "" {
+		app.render(w, r, "search.page.gohtml", &templateData{})
+		return
+	}
+
+	// Ask for one more result than we show, so that we know whether there's a next page.
+	s, err := app.snippets.Search(q, perPage+1, (p.Page-1)*perPage)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Use the new render helper.
-	app.render(w, r, "home.page.gohtml", &templateData{Snippets: s})
+	if p.Page > 1 {
+		p.PrevURL = fmt.Sprintf("/search?q=%s&page=%d", url.QueryEscape(q), p.Page-1)
+	}
+	if len(s) > perPage {
+		s = s[:perPage]
+		p.NextURL = fmt.Sprintf("/search?q=%s&page=%d", url.QueryEscape(q), p.Page+1)
+	}
+
+	app.render(w, r, "search.page.gohtml", &templateData{
+		Pagination: p,
+		Query:      q,
+		Snippets:   s,
+	})
 }
 
+// showSnippet keeps the old /snippet/:id URLs working by redirecting them to the snippet's
+// slug URL. Only snippets which the current user could see by ID are redirected, so the
+// sequential IDs can't be used to discover the slugs of unlisted snippets.
 func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
+	// Use the viewableSnippet helper to retrieve the data for the snippet identified by
+	// the ":id" URL parameter. If there's no matching record, or the current user isn't
+	// allowed to see it, a 404 Not Found response has already been sent.
+	s, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Scripts and API clients which ask for JSON or plain text get the snippet straight
+	// away, rather than following a redirect.
+	switch negotiate(r.Header.Get("Accept"), "text/html", "application/json", "text/plain") {
+	case "application/json", "text/plain":
+		if app.locked(r, s) {
+			app.notFound(w)
+			return
+		}
+		app.respond(w, r, snippetRepresentations(s))
+		return
+	}
+
+	// Browsers are sent to the snippet's canonical page. Visibility can change, so we use a
+	// temporary redirect to stop browsers and proxies from caching it.
+	w.Header().Add("Vary", "Accept")
+	http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusFound)
+}
+
+// showSnippetBySlug shows a snippet identified by its random slug. This is the canonical
+// URL of every snippet, and the only way for anyone but the author to reach an unlisted
+// snippet.
+func (app *application) showSnippetBySlug(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.snippetBySlug(w, r)
+	if !ok {
+		return
+	}
+
+	// Password-protected snippets get a form to unlock them instead. Like the confirmation
+	// page below, it's given nothing but the snippet's slug.
+	if app.locked(r, s) {
+		app.render(w, r, "unlock.page.gohtml", &templateData{
+			Form:    forms.NewForm(nil),
+			Snippet: &models.Snippet{Slug: s.Slug},
+		})
+		return
+	}
+
+	// Burn-after-reading snippets get a confirmation page instead, so that link previews
+	// and anything else which fetches the link don't use up a view. It's given a copy of
+	// the snippet with nothing but its slug and view limit, so that none of the snippet
+	// leaks into the page.
+	if app.viewLimited(r, s) {
+		w.Header().Set("Cache-Control", "no-store")
+		app.render(w, r, "reveal.page.gohtml", &templateData{
+			Snippet: &models.Snippet{Slug: s.Slug, ViewsLeft: s.ViewsLeft},
+		})
+		return
+	}
+
+	app.respond(w, r, snippetRepresentations(s))
+}
+
+// revealSnippet shows a burn-after-reading snippet, using up one of its views. It's reached
+// by the button on the snippet's confirmation page. When the last view is used up the
+// snippet is deleted, which is sent to the author's webhooks like any other deletion.
+func (app *application) revealSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.snippetBySlug(w, r)
+	if !ok {
+		return
+	}
+
+	// Snippets without a view limit, and authors' own snippets, are shown on their page
+	// as usual. So are locked snippets, where the page asks for the password first.
+	if !app.viewLimited(r, s) || app.locked(r, s) {
+		http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
+		return
+	}
+
+	// If someone else used up the last view in the meantime, the snippet is gone.
+	viewed, err := app.snippets.View(s.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if viewed.Burned() {
+		app.events.Notify(models.EventSnippetDeleted, viewed)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.render(w, r, "show.page.gohtml", &templateData{Snippet: viewed})
+}
+
+// snippetRepresentations returns the representations of a snippet: its page, the same JSON
+// as the API, and its raw content as plain text.
+func snippetRepresentations(s *models.Snippet) *representations {
+	return &representations{
+		Page: "show.page.gohtml",
+		Data: &templateData{Snippet: s},
+		JSON: s,
+		Text: s.Content,
+	}
+}
+
+// rawSnippet sends just the content of a snippet as plain text, which is handy for piping
+// snippets into scripts with curl. It's served both by ID and by slug, with the same
+// visibility rules as the snippet's page.
+func (app *application) rawSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.requestedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// The content could be anything, so stop browsers from sniffing it as HTML.
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.WriteString(w, s.Content); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// downloadSnippet sends the content of a snippet as a file attachment, named after the
+// snippet's title.
+func (app *application) downloadSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.requestedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": snippetFilename(s)}))
+	if _, err := io.WriteString(w, s.Content); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// embedSnippet shows a snippet on its own, without the navigation or anything else from the
+// base layout, to be framed in other sites' pages by embed.js. It's served without the
+// session, so only public snippets can be embedded: an embed is seen by everyone who reads
+// the page it's on, whoever pasted it there.
+func (app *application) embedSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.embeddableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderTemplate(w, "embed.page.gohtml", &templateData{Snippet: s})
+}
+
+// embeddableSnippet fetches the snippet identified by the ":id" URL parameter for an embed.
+// Embeds are served without the session, so password-protected snippets can't be unlocked
+// and aren't embeddable. Neither are encrypted snippets, since the key is only ever in the
+// fragment of the snippet's own link.
+func (app *application) embeddableSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, ok := app.viewableSnippet(w, r)
+	if ok && (s.Protected || s.Encrypted) {
+		app.notFound(w)
+		return nil, false
+	}
+	return s, ok
+}
+
+// embedScript is the JavaScript which embeds a snippet in the page that includes it. It
+// inserts an iframe showing the snippet's embed page right after the script element, and
+// resizes the frame to fit when the embed page reports its height.
+const embedScript = `(function () {
+	var script = document.currentScript;
+	var frame = document.createElement("iframe");
+	frame.src = %[1]s;
+	frame.title = %[2]s;
+	frame.style.width = "100%%";
+	frame.style.height = "200px";
+	frame.style.border = "0";
+	frame.setAttribute("loading", "lazy");
+	script.parentNode.insertBefore(frame, script.nextSibling);
+
+	window.addEventListener("message", function (e) {
+		if (e.source === frame.contentWindow && e.origin === %[3]s && e.data &&
+			e.data.snippetbox === "resize") {
+			frame.style.height = e.data.height + "px";
+		}
+	});
+})();
+`
+
+// embedSnippetScript sends the script which embeds a snippet, so that it can be pasted into
+// a wiki or docs page as a single script tag. The host page is on another site, so every
+// URL in the script is absolute.
+func (app *application) embedSnippetScript(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.embeddableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Encoding the strings as JSON makes them valid JavaScript string literals, with any
+	// quotes and angle brackets in the title escaped.
+	origin := app.baseURL
+	var literals [3][]byte
+	for i, v := range []string{fmt.Sprintf("%s/snippet/%d/embed", origin, s.ID), s.Title, origin} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		literals[i] = b
+	}
+
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := fmt.Fprintf(w, embedScript, literals[0], literals[1], literals[2]); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// requestedSnippet fetches the snippet identified by either the ":slug" or the ":id" URL
+// parameter, depending on the route, checking that the current user is allowed to see it.
+// If not, a 404 Not Found response is sent and requestedSnippet returns false.
+func (app *application) requestedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	var s *models.Snippet
+	var ok bool
+	if r.URL.Query().Get(":slug") == "" {
+		s, ok = app.viewableSnippet(w, r)
+	} else {
+		s, ok = app.snippetBySlug(w, r)
+		// Burn-after-reading snippets can only be seen by using up a view, so their
+		// content isn't served anywhere else.
+		if ok && app.viewLimited(r, s) {
+			app.notFound(w)
+			return nil, false
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+
+	// Password-protected snippets have to be unlocked on their page first.
+	if app.locked(r, s) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// snippetBySlug fetches the snippet identified by the ":slug" URL parameter, checking that
+// the current user is allowed to see it. If not, a 404 Not Found response is sent and
+// snippetBySlug returns false. Unlike requestedSnippet, it returns burn-after-reading
+// snippets, which the caller mustn't show without using up a view.
+func (app *application) snippetBySlug(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	slug := r.URL.Query().Get(":slug")
+
+	// Use the SnippetModel object's GetBySlug method to retrieve the data for a specific
+	// record based on its slug. If no matching record is found, return a 404 Not Found
+	// response.
+	s, err := app.snippets.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	if !app.canView(r, s, true) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// viewableSnippet fetches the snippet identified by the ":id" URL parameter, checking that
+// the current user is allowed to see it. Unauthorized access gets the same 404 Not Found
+// response as a missing snippet, so that we don't leak the existence of private snippets.
+func (app *application) viewableSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, err := app.findSnippet(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	return s, true
+}
+
+// findSnippet returns the snippet identified by the ":id" URL parameter. If the ID is
+// invalid, there's no such snippet, or the current user isn't allowed to see it, it returns
+// models.ErrNoRecord. Burn-after-reading snippets can only be seen by their slug, using up a
+// view, so only their author can find them by ID.
+func (app *application) findSnippet(r *http.Request) (*models.Snippet, error) {
 	// Pat doesn't strip the colon from the named capture key, so we need to
 	// get the value of ":id" from the query string instead of "id".
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil || id < 1 {
-		app.notFound(w)
-		return
+		return nil, models.ErrNoRecord
 	}
 
-	// Use the SnippetModel object's Get method to retrieve the data for a specific record
-	// based on its ID. If no matching record is found, return a 404 Not Found response.
 	s, err := app.snippets.Get(id)
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
+		return nil, err
+	}
+
+	if !app.canView(r, s, false) || app.viewLimited(r, s) {
+		return nil, models.ErrNoRecord
+	}
+
+	return s, nil
+}
+
+// canView reports whether the current user is allowed to see a snippet. Public snippets
+// can be seen by anyone, unlisted ones by anyone who knows their slug, and private ones
+// only by their author. bySlug says whether the snippet was requested by its slug.
+func (app *application) canView(r *http.Request, s *models.Snippet, bySlug bool) bool {
+	switch s.Visibility {
+	case models.VisibilityPublic:
+		return true
+	case models.VisibilityUnlisted:
+		if bySlug {
+			return true
+		}
+	}
+	return s.UserID != 0 && s.UserID == app.authenticatedUserID(r)
+}
+
+// viewLimited reports whether the current user can only see a snippet by using up one of
+// its views. Authors can always see their own burn-after-reading snippets for free.
+func (app *application) viewLimited(r *http.Request, s *models.Snippet) bool {
+	return s.ViewsLeft != nil && (s.UserID == 0 || s.UserID != app.authenticatedUserID(r))
+}
+
+// unlockClientAttempts is how many wrong guesses at a snippet's password each client network
+// may make in the window of app.unlockAttempts, and unlockSnippetAttempts is how many may be
+// made from every network together.
+const (
+	unlockClientAttempts  = 5
+	unlockSnippetAttempts = 20
+)
+
+// unlockedKey returns the session key which records that the current user has unlocked the
+// password-protected snippet with the given id.
+func unlockedKey(id int) string {
+	return fmt.Sprintf("unlockedSnippet:%d", id)
+}
+
+// locked reports whether a password-protected snippet is still locked for the current user.
+// Authors never need to unlock their own snippets, and everyone else unlocks each snippet
+// once per session. It uses the session, so it can only be called by handlers served with
+// it.
+func (app *application) locked(r *http.Request, s *models.Snippet) bool {
+	if !s.Protected || (s.UserID != 0 && s.UserID == app.authenticatedUserID(r)) {
+		return false
+	}
+	return !app.session.GetBool(r, unlockedKey(s.ID))
+}
+
+// unlockSnippet checks the password submitted to unlock a password-protected snippet. The
+// right password unlocks the snippet for the rest of the session, and the wrong one shows
+// the form again. Guesses at each snippet's password are throttled for each client network,
+// and for everyone together, so that switching addresses doesn't help either.
+func (app *application) unlockSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.snippetBySlug(w, r)
+	if !ok {
+		return
+	}
+
+	page := fmt.Sprintf("/s/%s", s.Slug)
+	if !app.locked(r, s) {
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.NewForm(r.PostForm)
+	td := &templateData{Form: form, Snippet: &models.Snippet{Slug: s.Slug}}
+
+	// Each guess is counted before the password is checked, and once the limit is reached,
+	// passwords aren't even checked until it's lifted.
+	limits := map[string]int{
+		fmt.Sprintf("unlock %d %s", s.ID, clientNetwork(r)): unlockClientAttempts,
+		fmt.Sprintf("unlock %d", s.ID):                      unlockSnippetAttempts,
+	}
+	now := time.Now()
+	if !app.unlockAttempts.attempt(now, limits) {
+		form.FormErrors.Add("generic", "Too many incorrect passwords. Please try again later.")
+		app.render(w, r, "unlock.page.gohtml", td)
+		return
+	}
+
+	err = app.snippets.CheckPassword(s.ID, form.Get("password"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			form.FormErrors.Add("generic", "Password is incorrect")
+			app.render(w, r, "unlock.page.gohtml", td)
+		case errors.Is(err, models.ErrNoRecord):
 			app.notFound(w)
-		} else {
+		default:
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	// Use the new render helper.
-	app.render(w, r, "show.page.gohtml", &templateData{
-		Snippet: s,
-	})
+	app.unlockAttempts.succeed(now, limits)
+	app.session.Put(r, unlockedKey(s.ID), true)
+	http.Redirect(w, r, page, http.StatusSeeOther)
 }
 
 // createSnippetForm handler creates/renders snippet form response.
@@ -83,9 +658,7 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 	// Create a new forms.Form struct containing the POSTed data from the form,
 	// then use the validation methods of forms.Form to check the content.
 	form := forms.NewForm(r.PostForm)
-	form.Required("title", "content", "expires")
-	form.MaxLength("title", 100)
-	form.PermittedValues("expires", "365", "7", "1")
+	validateSnippetForm(form, nil)
 
 	// If the form isn't valid, redisplay the template passing in the form.Form object
 	// as the data
@@ -96,14 +669,23 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 
 	// Because the form data (with type url.Values) has been anonymously embedded in the
 	// form.Form struct, we can use the Get() method to retrieve the validated value for a
-	// particular form field.
-	id, err := app.snippets.Insert(form.Get("title"), form.Get("content"),
-		form.Get("expires"))
+	// particular form field, which formSnippet does for each of the snippet's fields. The
+	// snippet is recorded against the currently logged-in user.
+	s := formSnippet(form)
+	s.UserID = app.authenticatedUserID(r)
+	id, slug, err := app.snippets.Insert(s)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	if err = app.snippets.SetTags(id, formTags(form)); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.notifySnippet(models.EventSnippetCreated, id)
+
 	// Use the session.Put() method to add a string value ("Your snippet was saved successfully")
 	// and the corresponding key ("flash") to the session data. Note that if there is no existing
 	// session for the current user (or their session has expired) then a new, empty,
@@ -111,7 +693,369 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 	app.session.Put(r, "flash", "Snippet successfully created!")
 
 	// Redirect the user to the relevant page for the created snippet
-	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/s/%s", slug), http.StatusSeeOther)
+}
+
+// Expiry options of the snippet form's "expires" field, besides a number of days (like the
+// one day, week and year presets). Snippets can be kept forever, for a custom number of
+// hours, days or months given by the "expires_amount" and "expires_unit" fields, or until
+// the date and time given by the "expires_at" field.
+const (
+	expiresNever  = "never"
+	expiresCustom = "custom"
+	expiresDate   = "date"
+)
+
+// expiresAtLayout is the layout of the "expires_at" field, which is what browsers send for a
+// datetime-local input. There's no time zone, so the time is taken to be UTC, which is how
+// the application shows every time.
+const expiresAtLayout = "2006-01-02T15:04"
+
+// maxExpiryYears is how far in the future a snippet can be set to expire, however its
+// expiry is chosen. The edit form shows a snippet's current expiry as a date, so custom
+// expiry durations mustn't be able to go beyond the latest date the form accepts.
+const maxExpiryYears = 10
+
+// maxViews is the largest view limit a burn-after-reading snippet can be given.
+const maxViews = 100
+
+// validateSnippetForm runs the validation checks shared by the create and edit snippet
+// forms. current is the expiry time of the snippet being edited, or nil; a date which keeps
+// it isn't checked, so that a snippet can be saved unchanged even in its last minute.
+func validateSnippetForm(form *forms.Form, current *time.Time) {
+	form.Required("title", "content", "expires", "visibility", "language", "format")
+	form.MaxLength("title", 100)
+	switch form.Get("expires") {
+	case expiresNever:
+	case expiresCustom:
+		form.Required("expires_amount", "expires_unit")
+		max := 999
+		if form.Get("expires_unit") == "months" {
+			max = 12 * maxExpiryYears
+		}
+		form.IntRange("expires_amount", 1, max)
+		form.PermittedValues("expires_unit", "hours", "days", "months")
+	case expiresDate:
+		form.Required("expires_at")
+		if !keepsExpiry(form, current) {
+			now := time.Now()
+			form.Date("expires_at", expiresAtLayout, now, now.AddDate(maxExpiryYears, 0, 0))
+		}
+	default:
+		form.IntRange("expires", 1, 999)
+	}
+	form.PermittedValues("visibility", models.VisibilityPublic, models.VisibilityUnlisted,
+		models.VisibilityPrivate)
+	form.PermittedValues("language", languageValues()...)
+	form.PermittedValues("format", models.FormatPlain, models.FormatMarkdown)
+	form.MaxItems("tags", 10)
+	form.ItemsMatchPattern("tags", forms.TagRX)
+	form.IntRange("max_views", 1, maxViews)
+	form.MinLength("password", 8)
+	// The content of an encrypted snippet is the ciphertext, encoded by main.js.
+	if form.Get("encrypted") != "" {
+		form.MatchesPattern("content", forms.Base64RX)
+	}
+}
+
+// keepsExpiry reports whether a snippet form keeps the expiry time current, which the edit
+// form fills in to the minute.
+func keepsExpiry(form *forms.Form, current *time.Time) bool {
+	return current != nil && form.Get("expires") == expiresDate &&
+		strings.TrimSpace(form.Get("expires_at")) == current.UTC().Format(expiresAtLayout)
+}
+
+// formSnippet returns a snippet holding the validated values of a snippet form.
+func formSnippet(form *forms.Form) *models.Snippet {
+	s := &models.Snippet{
+		Title:      form.Get("title"),
+		Content:    form.Get("content"),
+		Expires:    formExpiry(form, time.Now()),
+		Visibility: form.Get("visibility"),
+		Language:   form.Get("language"),
+		Format:     form.Get("format"),
+		ViewsLeft:  formMaxViews(form),
+		Password:   formPassword(form),
+		Encrypted:  form.Get("encrypted") != "",
+	}
+
+	// The server can't read encrypted snippets to highlight or render them, so they're
+	// always shown as plain text.
+	if s.Encrypted {
+		s.Language, s.Format = "text", models.FormatPlain
+	}
+
+	return s
+}
+
+// formPassword returns the password change asked for in a validated snippet form: nil to
+// keep the current password (if any), a pointer to an empty string to remove it, or the
+// new password.
+func formPassword(form *forms.Form) *string {
+	if form.Get("remove_password") != "" {
+		none := ""
+		return &none
+	}
+	if password := form.Get("password"); password != "" {
+		return &password
+	}
+	return nil
+}
+
+// formMaxViews returns the view limit chosen in a validated snippet form, or nil if the
+// field was left blank and the snippet can be viewed any number of times. The limit is only
+// offered when creating a snippet, so it's ignored when a snippet is edited.
+func formMaxViews(form *forms.Form) *int {
+	n, err := strconv.Atoi(strings.TrimSpace(form.Get("max_views")))
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+// formExpiry returns the expiry time chosen in a validated snippet form, counting from now,
+// or nil if the snippet never expires.
+func formExpiry(form *forms.Form, now time.Time) *time.Time {
+	var t time.Time
+	switch form.Get("expires") {
+	case expiresNever:
+		return nil
+	case expiresCustom:
+		n, _ := strconv.Atoi(strings.TrimSpace(form.Get("expires_amount")))
+		switch form.Get("expires_unit") {
+		case "hours":
+			t = now.Add(time.Duration(n) * time.Hour)
+		case "days":
+			t = now.AddDate(0, 0, n)
+		default:
+			t = now.AddDate(0, n, 0)
+		}
+	case expiresDate:
+		t, _ = time.Parse(expiresAtLayout, strings.TrimSpace(form.Get("expires_at")))
+	default:
+		days, _ := strconv.Atoi(strings.TrimSpace(form.Get("expires")))
+		t = now.AddDate(0, 0, days)
+	}
+	t = t.UTC()
+	return &t
+}
+
+// formTags returns the tags from the comma-separated "tags" field of a snippet form. Tags
+// are case-insensitive, so they're normalized to lower case.
+func formTags(form *forms.Form) []string {
+	return forms.SplitList(strings.ToLower(form.Get("tags")))
+}
+
+// ownSnippet fetches the snippet identified by the ":id" URL parameter, checking that it
+// was created by the currently logged-in user. If the snippet can't be found, or belongs to
+// someone else, an appropriate error response is sent and ownSnippet returns false. Snippets
+// which the user isn't allowed to see are not found, rather than forbidden, so that their
+// IDs can't be used to discover private snippets.
+func (app *application) ownSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, err := app.findSnippet(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	if s.UserID == 0 || s.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// editSnippetForm renders the edit form for a snippet, pre-populated with its current
+// title, content and settings.
+func (app *application) editSnippetForm(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.NewForm(url.Values{})
+	form.Set("title", s.Title)
+	form.Set("content", s.Content)
+	form.Set("tags", strings.Join(s.Tags, ", "))
+	form.Set("visibility", s.Visibility)
+	form.Set("language", s.Language)
+	form.Set("format", s.Format)
+	if s.Encrypted {
+		form.Set("encrypted", "true")
+	}
+	// Keep the snippet's expiry time unless the author chooses another.
+	if s.Expires == nil {
+		form.Set("expires", expiresNever)
+	} else {
+		form.Set("expires", expiresDate)
+		form.Set("expires_at", s.Expires.UTC().Format(expiresAtLayout))
+	}
+
+	app.render(w, r, "edit.page.gohtml", &templateData{
+		Form:    form,
+		Snippet: s,
+	})
+}
+
+// editSnippet handles updates to an existing snippet. It uses the same validation rules as
+// createSnippet, and only the author of the snippet is allowed to update it.
+func (app *application) editSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Snippets can't be encrypted or decrypted by editing them, so the content is validated
+	// according to the snippet, whatever the form says.
+	form := forms.NewForm(r.PostForm)
+	form.Del("encrypted")
+	if s.Encrypted {
+		form.Set("encrypted", "true")
+	}
+	validateSnippetForm(form, s.Expires)
+
+	if !form.Valid() {
+		app.render(w, r, "edit.page.gohtml", &templateData{Form: form, Snippet: s})
+		return
+	}
+
+	updated := formSnippet(form)
+	updated.ID, updated.UserID = s.ID, app.authenticatedUserID(r)
+	// The form only shows the expiry time to the minute, so keep the exact time if it's
+	// unchanged.
+	if keepsExpiry(form, s.Expires) {
+		updated.Expires = s.Expires
+	}
+	err = app.snippets.Update(updated)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if err = app.snippets.SetTags(s.ID, formTags(form)); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.notifySnippet(models.EventSnippetUpdated, s.ID)
+
+	app.session.Put(r, "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/s/%s", s.Slug), http.StatusSeeOther)
+}
+
+// deleteSnippetForm renders a page asking the author to confirm that they want to delete
+// their snippet.
+func (app *application) deleteSnippetForm(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.render(w, r, "delete.page.gohtml", &templateData{Snippet: s})
+}
+
+// deleteSnippet deletes a snippet before it expires. Only the author of the snippet is
+// allowed to delete it.
+func (app *application) deleteSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// The model also checks the snippet's owner, so if it was deleted (or changed hands)
+	// since we fetched it we get an ErrNoRecord error.
+	err := app.snippets.Delete(s.ID, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.events.Notify(models.EventSnippetDeleted, s)
+
+	app.session.Put(r, "flash", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// snippetHistory lists every revision of a snippet, and shows a unified diff between two
+// of them. The revisions to compare are chosen with the "from" and "to" query string
+// parameters; by default the latest revision is compared with the one before it.
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.requestedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(s.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	td := &templateData{Snippet: s, Revisions: revisions}
+
+	// Revisions are ordered most recent first, so the defaults are the first two.
+	if len(revisions) > 1 {
+		td.DiffFrom, td.DiffTo = revisions[1], revisions[0]
+	}
+
+	if from := r.URL.Query().Get("from"); from != "" {
+		if td.DiffFrom = findRevision(revisions, from); td.DiffFrom == nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		if td.DiffTo = findRevision(revisions, to); td.DiffTo == nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if td.DiffFrom != nil && td.DiffTo != nil {
+		td.Diff = diff.Unified(td.DiffFrom.Content, td.DiffTo.Content, 3)
+	}
+
+	app.render(w, r, "history.page.gohtml", td)
+}
+
+// findRevision returns the revision whose ID matches the string value, or nil if there's
+// no such revision.
+func findRevision(revisions []*models.Revision, value string) *models.Revision {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	for _, rev := range revisions {
+		if rev.ID == id {
+			return rev
+		}
+	}
+	return nil
 }
 
 // signupUserForm handles the signup user form.
@@ -211,3 +1155,225 @@ func (app application) logoutUser(w http.ResponseWriter, r *http.Request) {
 	app.session.Put(r, "flash", "You've been logged out successfully!")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// listTokens renders the API token settings page, listing the user's tokens alongside a form
+// to create a new one. A newly created token is shown once, straight after it's created.
+func (app *application) listTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, forms.NewForm(nil))
+}
+
+// renderTokens renders the API token settings page with the given form.
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	tokens, err := app.tokens.List(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "tokens.page.gohtml", &templateData{
+		Form:     form,
+		NewToken: app.session.PopString(r, "newAPIToken"),
+		Tokens:   tokens,
+	})
+}
+
+// createToken creates a new API token for the user. The token can't be recovered once it's
+// stored, so it's passed to the settings page through the session to be shown just once.
+func (app *application) createToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.NewForm(r.PostForm)
+	validateTokenForm(form)
+	if !form.Valid() {
+		app.renderTokens(w, r, form)
+		return
+	}
+
+	// The zero time means the token never expires.
+	var expires time.Time
+	if days, err := strconv.Atoi(form.Get("expires")); err == nil {
+		expires = time.Now().UTC().AddDate(0, 0, days)
+	}
+
+	token, err := app.tokens.Insert(app.authenticatedUserID(r), form.Get("name"), expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "newAPIToken", token)
+	app.session.Put(r, "flash", "Token successfully created!")
+
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
+// validateTokenForm runs the validation checks for creating an API token, which are shared
+// with the JSON API.
+func validateTokenForm(form *forms.Form) {
+	form.Required("name", "expires")
+	form.MaxLength("name", 100)
+	form.PermittedValues("expires", "never", "30", "90", "365")
+}
+
+// revokeToken deletes one of the user's API tokens, so that it can no longer be used.
+func (app *application) revokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.tokens.Revoke(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.session.Put(r, "flash", "Token successfully revoked!")
+
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
+// listWebhooks renders the webhook settings page, listing the user's webhooks alongside a
+// form to register a new one. The form is prefilled with a random secret, and subscribed to
+// every event.
+func (app *application) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderWebhooks(w, r, forms.NewForm(url.Values{
+		"secret": {hex.EncodeToString(b)},
+		"events": models.Events,
+	}))
+}
+
+// renderWebhooks renders the webhook settings page with the given form.
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	webhooks, err := app.webhooks.List(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "webhooks.page.gohtml", &templateData{Form: form, Webhooks: webhooks})
+}
+
+// createWebhook registers a new webhook for the user.
+func (app *application) createWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.NewForm(r.PostForm)
+	form.Required("url", "secret", "events")
+	form.MaxLength("url", 2048)
+	form.WebURL("url")
+	if form.FormErrors.Get("url") == "" && !publicURL(form.Get("url")) {
+		form.FormErrors.Add("url", "This field must be a public address")
+	}
+	form.MinLength("secret", 16)
+	form.MaxLength("secret", 255)
+	form.PermittedItems("events", models.Events...)
+
+	if !form.Valid() {
+		app.renderWebhooks(w, r, form)
+		return
+	}
+
+	_, err = app.webhooks.Insert(&models.Webhook{
+		UserID: app.authenticatedUserID(r),
+		URL:    form.Get("url"),
+		Secret: form.Get("secret"),
+		Events: form.Values["events"],
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Webhook successfully created!")
+
+	http.Redirect(w, r, "/user/webhooks", http.StatusSeeOther)
+}
+
+// publicURL reports whether a webhook URL might be for a public address. Host names are
+// only resolved when each event is delivered, and the dispatcher refuses to connect to
+// anything but public addresses then, but URLs which are obviously internal are rejected
+// straight away.
+func publicURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return webhook.IsPublic(ip)
+	}
+	return true
+}
+
+// showWebhook shows one of the user's webhooks, with a log of its most recent deliveries.
+func (app *application) showWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	hook, err := app.webhooks.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	deliveries, err := app.webhooks.Deliveries(hook.ID, 50)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "webhook.page.gohtml", &templateData{Webhook: hook, Deliveries: deliveries})
+}
+
+// deleteWebhook deletes one of the user's webhooks, along with its delivery log.
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.webhooks.Delete(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.session.Put(r, "flash", "Webhook successfully deleted!")
+
+	http.Redirect(w, r, "/user/webhooks", http.StatusSeeOther)
+}
@@ -2,9 +2,18 @@ package main
 
 import (
 	"bytes"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/forms"
+	"github.com/DataDavD/snippetbox/pkg/models"
+	"github.com/DataDavD/snippetbox/pkg/models/mock"
 )
 
 // TestPing tests ping handler for the correct response status code, 200 and
@@ -27,6 +36,112 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestBrowseSnippets(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"First page", "/snippets", http.StatusOK, []byte("An old silent pond")},
+		{"Page count", "/snippets?per_page=10", http.StatusOK, []byte("Page 1 of 1 (1 snippets)")},
+		{"With cursor", "/snippets?page=2&after=1545585922000000000-1", http.StatusOK,
+			[]byte("There's nothing to see here yet!")},
+		{"Invalid page", "/snippets?page=0", http.StatusBadRequest, nil},
+		{"Invalid per_page", "/snippets?per_page=1000", http.StatusBadRequest, nil},
+		{"Invalid cursor", "/snippets?page=2&after=foo", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestSearchSnippets(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"No query", "/search", http.StatusOK, []byte(`<input type="text" name="q" id="q" value="">`)},
+		{"Match", "/search?q=silent", http.StatusOK, []byte("An old <mark>silent</mark> pond...")},
+		{"No match", "/search?q=frog", http.StatusOK, []byte("No snippets match your search.")},
+		{"Invalid page", "/search?q=silent&page=foo", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestTagSnippets tests the tag listing page and the tag filter on the home page.
+func TestTagSnippets(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Tag page", "/tag/poetry", http.StatusOK, []byte("An old silent pond")},
+		{"Tag page case insensitive", "/tag/Poetry", http.StatusOK, []byte("An old silent pond")},
+		{"Unused tag", "/tag/k8s", http.StatusOK, []byte("There are no snippets with this tag.")},
+		{"Invalid tag", "/tag/not%20a%20tag", http.StatusNotFound, nil},
+		{"Home filter", "/?tag=poetry", http.StatusOK, []byte("An old silent pond")},
+		{"Home filter unused tag", "/?tag=k8s", http.StatusOK,
+			[]byte("There's nothing to see here yet!")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
 func TestShowSnippet(t *testing.T) {
 	t.Parallel()
 	// Create a new instance of our application struct which uses the mocked
@@ -45,13 +160,31 @@ func TestShowSnippet(t *testing.T) {
 		wantCode int
 		wantBody []byte
 	}{
-		{"Valid ID", "/snippet/1", http.StatusOK, []byte("An old silent pond...")},
+		{"Valid slug", "/s/anOldSilentPond0000001", http.StatusOK, []byte("An old silent pond...")},
+		{"Shows author", "/s/anOldSilentPond0000001", http.StatusOK, []byte("by Alice")},
+		{"Shows tags", "/s/anOldSilentPond0000001", http.StatusOK,
+			[]byte(`<a class="tag" href="/tag/poetry">poetry</a>`)},
+		{"Highlights content", "/s/anOldSilentPond0000001", http.StatusOK,
+			[]byte(`<pre tabindex="0" class="chroma">`)},
+		{"Renders Markdown", "/s/onboardingNotes0000007", http.StatusOK,
+			[]byte("<h1>Onboarding</h1>")},
+		{"Valid ID", "/snippet/1", http.StatusFound, nil},
 		{"Non-existent ID", "/snippet/2", http.StatusNotFound, nil},
 		{"Negative ID", "/snippet/-1", http.StatusNotFound, nil},
 		{"Decimal ID", "/snippet/1.23", http.StatusNotFound, nil},
 		{"String ID", "/snippet/foo", http.StatusNotFound, nil},
 		{"Empty ID", "/snippet/", http.StatusNotFound, nil},
 		{"Trailing slash", "/snippet/1/", http.StatusNotFound, nil},
+		{"Private snippet", "/snippet/4", http.StatusNotFound, nil},
+		{"Unlisted snippet by ID", "/snippet/5", http.StatusNotFound, nil},
+		{"Unlisted snippet by slug", "/s/bobsUnlistedSnippetSlg", http.StatusOK,
+			[]byte("Bob&#39;s unlisted snippet...")},
+		{"Unlisted snippet history", "/snippet/5/history", http.StatusNotFound, nil},
+		{"Private snippet history", "/snippet/4/history", http.StatusNotFound, nil},
+		{"Private snippet by slug", "/s/bobsPrivateSnippet0004", http.StatusNotFound, nil},
+		{"Non-existent slug", "/s/foo", http.StatusNotFound, nil},
+		{"Never expires", "/s/overTheWintryForest003", http.StatusOK,
+			[]byte("<time>Expires: Never</time>")},
 	}
 
 	for _, tt := range tests {
@@ -76,6 +209,1358 @@ func TestShowSnippet(t *testing.T) {
 		})
 	}
 
+	// The old ID URLs redirect to the slug URL.
+	t.Run("Redirect to slug", func(t *testing.T) {
+		_, header, _ := ts.get(t, "/snippet/1")
+		if loc := header.Get("Location"); loc != "/s/anOldSilentPond0000001" {
+			t.Errorf("want Location %q; got %q", "/s/anOldSilentPond0000001", loc)
+		}
+	})
+
+	// Once logged in as Alice, her own private snippet is visible but Bob's isn't.
+	ts.login(t)
+
+	for _, tt := range []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Own private snippet", "/s/alicesPrivateSnippet06", http.StatusOK},
+		{"Own private snippet by ID", "/snippet/6", http.StatusFound},
+		{"Other user's private snippet", "/s/bobsPrivateSnippet0004", http.StatusNotFound},
+		{"Other user's private snippet by ID", "/snippet/4", http.StatusNotFound},
+		{"Other user's unlisted snippet by ID", "/snippet/5", http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+// validSnippetForm returns the values of a valid submission of the snippet form.
+func validSnippetForm() url.Values {
+	return url.Values{
+		"title":      {"Title"},
+		"content":    {"Content"},
+		"expires":    {"7"},
+		"tags":       {""},
+		"visibility": {"public"},
+		"language":   {"text"},
+		"format":     {"plain"},
+	}
+}
+
+// TestCreateSnippet tests that only authenticated users can create snippets, and that a
+// valid submission redirects to the newly created snippet.
+func TestCreateSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/create")
+		if code != http.StatusSeeOther {
+			t.Errorf("want %d; got %d", http.StatusSeeOther, code)
+		}
+		if loc := header.Get("Location"); loc != "/user/login" {
+			t.Errorf("want Location %q; got %q", "/user/login", loc)
+		}
+	})
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	// Each test case changes a single field of an otherwise valid submission.
+	tests := []struct {
+		name     string
+		field    string
+		value    string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid submission", "", "", http.StatusSeeOther, nil},
+		{"Valid tags", "tags", "k8s, SQL,onboarding", http.StatusSeeOther, nil},
+		{"Unlisted", "visibility", "unlisted", http.StatusSeeOther, nil},
+		{"Private", "visibility", "private", http.StatusSeeOther, nil},
+		{"Language", "language", "go", http.StatusSeeOther, nil},
+		{"Markdown", "format", "markdown", http.StatusSeeOther, nil},
+		{"Empty title", "title", "", http.StatusOK, []byte("This field cannot be blank")},
+		{"Custom number of days", "expires", "30", http.StatusSeeOther, nil},
+		{"Never expires", "expires", "never", http.StatusSeeOther, nil},
+		{"Invalid expires", "expires", "1000", http.StatusOK,
+			[]byte("This field must be between 1 and 999")},
+		{"Custom expiry without amount", "expires", "custom", http.StatusOK,
+			[]byte("This field cannot be blank")},
+		{"Expiry date without date", "expires", "date", http.StatusOK,
+			[]byte("This field cannot be blank")},
+		{"Invalid visibility", "visibility", "secret", http.StatusOK,
+			[]byte("This field is invalid")},
+		{"Invalid language", "language", "cobol", http.StatusOK, []byte("This field is invalid")},
+		{"Invalid format", "format", "html", http.StatusOK, []byte("This field is invalid")},
+		{"Invalid tag", "tags", "k8s, not a tag", http.StatusOK,
+			[]byte("&#34;not a tag&#34; is invalid")},
+		{"Too many tags", "tags", "a,b,c,d,e,f,g,h,i,j,k", http.StatusOK,
+			[]byte("This field has too many items (maximum is 10)")},
+		{"Burn after reading", "max_views", "1", http.StatusSeeOther, nil},
+		{"Password", "password", "correct horse", http.StatusSeeOther, nil},
+		{"Short password", "password", "horse", http.StatusOK,
+			[]byte("This field is too short (minimum is 8 characters)")},
+		{"Encrypted without ciphertext", "encrypted", "true", http.StatusOK,
+			[]byte("This field is invalid")},
+		{"Invalid max views", "max_views", "101", http.StatusOK,
+			[]byte("This field must be between 1 and 100")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := validSnippetForm()
+			if tt.field != "" {
+				form.Set(tt.field, tt.value)
+			}
+			form.Add("csrf_token", csrfToken)
+
+			code, header, body := ts.postForm(t, "/snippet/create", form)
+			t.Logf("testing %q for want-code %d and want-body %q", tt.name, tt.wantCode,
+				tt.wantBody)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			// New snippets are shown at their slug URL.
+			if code == http.StatusSeeOther {
+				if loc := header.Get("Location"); loc != "/s/anOldSilentPond0000001" {
+					t.Errorf("want Location %q; got %q", "/s/anOldSilentPond0000001", loc)
+				}
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestFormExpiry tests the validation of the snippet form's expiry options, and the expiry
+// times they give.
+func TestFormExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, 1, 31, 12, 0, 0, 0, time.UTC)
+	nextWeek := time.Now().UTC().AddDate(0, 0, 7).Truncate(time.Minute)
+
+	tests := []struct {
+		name      string
+		values    url.Values
+		wantError string
+		want      *time.Time
+	}{
+		{"Preset days", url.Values{"expires": {"7"}}, "", timePtr(now.AddDate(0, 0, 7))},
+		{"Never", url.Values{"expires": {"never"}}, "", nil},
+		{"Custom hours", url.Values{"expires": {"custom"}, "expires_amount": {"36"},
+			"expires_unit": {"hours"}}, "", timePtr(now.Add(36 * time.Hour))},
+		{"Custom days", url.Values{"expires": {"custom"}, "expires_amount": {"3"},
+			"expires_unit": {"days"}}, "", timePtr(now.AddDate(0, 0, 3))},
+		{"Custom months", url.Values{"expires": {"custom"}, "expires_amount": {"2"},
+			"expires_unit": {"months"}}, "", timePtr(now.AddDate(0, 2, 0))},
+		{"Date", url.Values{"expires": {"date"},
+			"expires_at": {nextWeek.Format(expiresAtLayout)}}, "", timePtr(nextWeek)},
+		{"Zero days", url.Values{"expires": {"0"}}, "expires", nil},
+		{"Unknown option", url.Values{"expires": {"forever"}}, "expires", nil},
+		{"Custom amount too large", url.Values{"expires": {"custom"},
+			"expires_amount": {"1000"}, "expires_unit": {"days"}}, "expires_amount", nil},
+		{"Custom months too large", url.Values{"expires": {"custom"},
+			"expires_amount": {"121"}, "expires_unit": {"months"}}, "expires_amount", nil},
+		{"Custom amount not a number", url.Values{"expires": {"custom"},
+			"expires_amount": {"1.5"}, "expires_unit": {"days"}}, "expires_amount", nil},
+		{"Invalid unit", url.Values{"expires": {"custom"}, "expires_amount": {"1"},
+			"expires_unit": {"years"}}, "expires_unit", nil},
+		{"Invalid date", url.Values{"expires": {"date"}, "expires_at": {"31/01/2021"}},
+			"expires_at", nil},
+		{"Past date", url.Values{"expires": {"date"}, "expires_at": {"2021-01-31T12:00"}},
+			"expires_at", nil},
+		{"Distant date", url.Values{"expires": {"date"}, "expires_at": {"2999-01-01T00:00"}},
+			"expires_at", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := validSnippetForm()
+			for field, v := range tt.values {
+				values[field] = v
+			}
+			form := forms.NewForm(values)
+			validateSnippetForm(form, nil)
+
+			if tt.wantError != "" {
+				if form.FormErrors.Get(tt.wantError) == "" {
+					t.Errorf("want an error for %s; got %v", tt.wantError, form.FormErrors)
+				}
+				return
+			}
+			if !form.Valid() {
+				t.Fatalf("want a valid form; got %v", form.FormErrors)
+			}
+
+			got := formExpiry(form, now)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("want expiry %v; got %v", tt.want, got)
+			}
+		})
+	}
+
+	// The longest custom expiry must still be accepted by the edit form, which shows it as a
+	// date.
+	t.Run("Longest custom expiry as a date", func(t *testing.T) {
+		values := validSnippetForm()
+		values.Set("expires", "custom")
+		values.Set("expires_amount", strconv.Itoa(12*maxExpiryYears))
+		values.Set("expires_unit", "months")
+		form := forms.NewForm(values)
+		validateSnippetForm(form, nil)
+		if !form.Valid() {
+			t.Fatalf("want a valid form; got %v", form.FormErrors)
+		}
+
+		expires := formExpiry(form, time.Now())
+		values.Set("expires", "date")
+		values.Set("expires_at", expires.Format(expiresAtLayout))
+		form = forms.NewForm(values)
+		validateSnippetForm(form, nil)
+		if !form.Valid() {
+			t.Errorf("want a valid form; got %v", form.FormErrors)
+		}
+	})
+
+	// The edit form shows a snippet's expiry to the minute, so a snippet expiring within
+	// the current minute must still be saved with its expiry unchanged.
+	t.Run("Unchanged expiry in its last minute", func(t *testing.T) {
+		current := time.Now().UTC().Truncate(time.Minute).Add(59 * time.Second)
+		values := validSnippetForm()
+		values.Set("expires", "date")
+		values.Set("expires_at", current.Format(expiresAtLayout))
+
+		form := forms.NewForm(values)
+		validateSnippetForm(form, &current)
+		if !form.Valid() {
+			t.Fatalf("want a valid form; got %v", form.FormErrors)
+		}
+		if !keepsExpiry(form, &current) {
+			t.Error("want the expiry kept; got changed")
+		}
+
+		// A new expiry in the past is still refused.
+		form = forms.NewForm(values)
+		validateSnippetForm(form, timePtr(current.Add(time.Hour)))
+		if form.FormErrors.Get("expires_at") == "" {
+			t.Errorf("want an error for expires_at; got %v", form.FormErrors)
+		}
+	})
+}
+
+// timePtr returns a pointer to t, for optional times like a snippet's expiry.
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// TestEditSnippet tests that the author of a snippet can edit it, and that other users
+// cannot.
+func TestEditSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	getTests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Own snippet", "/snippet/1/edit", http.StatusOK, []byte("An old silent pond...")},
+		{"Keeps expiry", "/snippet/1/edit", http.StatusOK,
+			[]byte(`name="expires" value="date" checked`)},
+		{"Other user's snippet", "/snippet/3/edit", http.StatusForbidden, nil},
+		{"Other user's private snippet", "/snippet/4/edit", http.StatusNotFound, nil},
+		{"Other user's unlisted snippet", "/snippet/5/edit", http.StatusNotFound, nil},
+		{"Other user's burn-after-reading snippet", "/snippet/8/edit", http.StatusNotFound, nil},
+		{"Non-existent ID", "/snippet/2/edit", http.StatusNotFound, nil},
+		{"String ID", "/snippet/foo/edit", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range getTests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+
+	_, _, body := ts.get(t, "/snippet/1/edit")
+	csrfToken := extractCSRFToken(t, body)
+
+	postTests := []struct {
+		name         string
+		urlPath      string
+		title        string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Valid submission", "/snippet/1/edit", "New title", http.StatusSeeOther,
+			"/s/anOldSilentPond0000001", nil},
+		{"Empty title", "/snippet/1/edit", "", http.StatusOK, "",
+			[]byte("This field cannot be blank")},
+		{"Other user's snippet", "/snippet/3/edit", "New title", http.StatusForbidden, "", nil},
+		{"Other user's private snippet", "/snippet/4/edit", "New title", http.StatusNotFound, "",
+			nil},
+	}
+
+	for _, tt := range postTests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := validSnippetForm()
+			form.Set("title", tt.title)
+			form.Add("csrf_token", csrfToken)
+
+			code, header, body := ts.postForm(t, tt.urlPath, form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want Location %q; got %q", tt.wantLocation, loc)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestDeleteSnippet tests that the author of a snippet can delete it after confirming, that
+// other users cannot, and that the form is protected against CSRF.
+func TestDeleteSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/snippet/1/delete")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if want := []byte("Are you sure you want to delete"); !bytes.Contains(body, want) {
+		t.Errorf("want body to contain %q, but got %q", want, body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		csrfToken    string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Own snippet", "/snippet/1/delete", csrfToken, http.StatusSeeOther, "/"},
+		{"Other user's snippet", "/snippet/3/delete", csrfToken, http.StatusForbidden, ""},
+		{"Other user's private snippet", "/snippet/4/delete", csrfToken, http.StatusNotFound, ""},
+		{"Non-existent ID", "/snippet/2/delete", csrfToken, http.StatusNotFound, ""},
+		{"Invalid CSRF Token", "/snippet/1/delete", "wrongToken", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want Location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+}
+
+// TestAPITokens tests that users can create and revoke their personal API tokens, and that
+// a new token is shown exactly once.
+func TestAPITokens(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, _ := ts.get(t, "/user/tokens")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Fatalf("want redirect to /user/login; got %d %q", code, header.Get("Location"))
+	}
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/user/tokens")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if want := []byte("laptop"); !bytes.Contains(body, want) {
+		t.Errorf("want body to contain %q, but got %q", want, body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		tokenName    string
+		expires      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Empty name", "/user/tokens", "", "30", http.StatusOK, ""},
+		{"Long name", "/user/tokens", strings.Repeat("a", 101), "30", http.StatusOK, ""},
+		{"Invalid expiry", "/user/tokens", "ci", "7", http.StatusOK, ""},
+		{"Create never expiring", "/user/tokens", "ci", "never", http.StatusSeeOther,
+			"/user/tokens"},
+		{"Create", "/user/tokens", "ci", "30", http.StatusSeeOther, "/user/tokens"},
+		{"Revoke", "/user/tokens/1/revoke", "", "", http.StatusSeeOther, "/user/tokens"},
+		{"Revoke non-existent token", "/user/tokens/2/revoke", "", "", http.StatusNotFound, ""},
+		{"Revoke invalid ID", "/user/tokens/foo/revoke", "", "", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("name", tt.tokenName)
+			form.Add("expires", tt.expires)
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want Location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+
+	// The token created above is only shown on the next page view.
+	_, _, body = ts.get(t, "/user/tokens")
+	if want := []byte(mock.MockToken); !bytes.Contains(body, want) {
+		t.Errorf("want body to contain %q, but got %q", want, body)
+	}
+	_, _, body = ts.get(t, "/user/tokens")
+	if want := []byte(mock.MockToken); bytes.Contains(body, want) {
+		t.Errorf("want body not to contain %q", want)
+	}
+}
+
+// TestWebhooks tests that users can register and delete webhooks, and see their delivery
+// log.
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, _ := ts.get(t, "/user/webhooks")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Fatalf("want redirect to /user/login; got %d %q", code, header.Get("Location"))
+	}
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/user/webhooks")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if want := []byte("https://chat.example.com/hooks/snippetbox"); !bytes.Contains(body, want) {
+		t.Errorf("want body to contain %q, but got %q", want, body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	for _, tt := range []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Delivery log", "/user/webhooks/1", http.StatusOK, "Service Unavailable"},
+		{"Other user's webhook", "/user/webhooks/2", http.StatusNotFound, ""},
+		{"Invalid ID", "/user/webhooks/foo", http.StatusNotFound, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, []byte(tt.wantBody)) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+
+	valid := func() url.Values {
+		return url.Values{
+			"csrf_token": {csrfToken},
+			"url":        {"https://example.com/hook"},
+			"secret":     {"0123456789abcdef"},
+			"events":     {models.EventSnippetCreated, models.EventSnippetExpired},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		field        string
+		value        []string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Create", "/user/webhooks", "", nil, http.StatusSeeOther, "/user/webhooks"},
+		{"Invalid URL scheme", "/user/webhooks", "url", []string{"ftp://example.com"},
+			http.StatusOK, ""},
+		{"Relative URL", "/user/webhooks", "url", []string{"/hook"}, http.StatusOK, ""},
+		{"Loopback URL", "/user/webhooks", "url", []string{"http://127.0.0.1:8080/hook"},
+			http.StatusOK, ""},
+		{"Localhost URL", "/user/webhooks", "url", []string{"http://localhost/hook"},
+			http.StatusOK, ""},
+		{"Metadata service URL", "/user/webhooks", "url",
+			[]string{"http://169.254.169.254/latest/meta-data/"}, http.StatusOK, ""},
+		{"Short secret", "/user/webhooks", "secret", []string{"s3cr3t"}, http.StatusOK, ""},
+		{"No events", "/user/webhooks", "events", nil, http.StatusOK, ""},
+		{"Invalid event", "/user/webhooks", "events", []string{"snippet.viewed"},
+			http.StatusOK, ""},
+		{"Delete", "/user/webhooks/1/delete", "", nil, http.StatusSeeOther, "/user/webhooks"},
+		{"Delete other user's webhook", "/user/webhooks/2/delete", "", nil,
+			http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := valid()
+			if tt.field != "" {
+				form[tt.field] = tt.value
+			}
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want Location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+}
+
+// TestSnippetEvents tests that webhook events are sent when snippets are created, edited or
+// deleted, through both the HTML forms and the API.
+func TestSnippetEvents(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	events := app.events.(*recordingNotifier)
+	alice := bearerToken(mock.MockToken)
+	valid := `{"title": "Title", "content": "Content", "expires": 7}`
+
+	ts.login(t)
+	_, _, body := ts.get(t, "/snippet/create")
+	form := validSnippetForm()
+	form.Set("csrf_token", extractCSRFToken(t, body))
+
+	tests := []struct {
+		name       string
+		send       func()
+		wantEvents []string
+	}{
+		{"Create", func() { ts.postForm(t, "/snippet/create", form) },
+			[]string{"snippet.created 1"}},
+		{"Invalid create", func() {
+			invalid := validSnippetForm()
+			invalid.Set("csrf_token", form.Get("csrf_token"))
+			invalid.Set("title", "")
+			ts.postForm(t, "/snippet/create", invalid)
+		}, nil},
+		{"Edit", func() { ts.postForm(t, "/snippet/1/edit", form) },
+			[]string{"snippet.updated 1"}},
+		{"Edit other user's snippet", func() { ts.postForm(t, "/snippet/3/edit", form) }, nil},
+		{"Delete", func() { ts.postForm(t, "/snippet/1/delete", form) },
+			[]string{"snippet.deleted 1"}},
+		{"API create", func() {
+			ts.do(t, http.MethodPost, "/api/v1/snippets", strings.NewReader(valid), alice)
+		}, []string{"snippet.created 1"}},
+		{"API update", func() {
+			ts.do(t, http.MethodPut, "/api/v1/snippets/1", strings.NewReader(valid), alice)
+		}, []string{"snippet.updated 1"}},
+		{"API delete", func() {
+			ts.do(t, http.MethodDelete, "/api/v1/snippets/1", nil, alice)
+		}, []string{"snippet.deleted 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.send()
+			got := events.take()
+			if strings.Join(got, ",") != strings.Join(tt.wantEvents, ",") {
+				t.Errorf("want events %q; got %q", tt.wantEvents, got)
+			}
+		})
+	}
+}
+
+// TestNotifyExpired tests that webhook events are sent for the snippets which expired in a
+// period of time.
+func TestNotifyExpired(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	events := app.events.(*recordingNotifier)
+
+	s, err := app.snippets.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := *s.Expires
+	app.notifyExpired(expires.Add(-time.Minute), expires)
+	if got := events.take(); len(got) != 1 || got[0] != "snippet.expired 1" {
+		t.Errorf("want events %q; got %q", []string{"snippet.expired 1"}, got)
+	}
+
+	app.notifyExpired(expires, expires.Add(time.Minute))
+	if got := events.take(); len(got) != 0 {
+		t.Errorf("want no events; got %q", got)
+	}
+}
+
+// memoryCheckpoints keeps checkpoints in memory, in place of the checkpoints table.
+type memoryCheckpoints struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func (c *memoryCheckpoints) Get(name string) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.times[name]
+	if !ok {
+		return time.Time{}, models.ErrNoRecord
+	}
+	return t, nil
+}
+
+func (c *memoryCheckpoints) Set(name string, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.times[name] = t
+	return nil
+}
+
+// TestExpiryWatcher tests that the expiry watcher catches up on the snippets which expired
+// while the application was down, and records how far it's got.
+func TestExpiryWatcher(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	events := app.events.(*recordingNotifier)
+
+	s, err := app.snippets.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := *s.Expires
+
+	// The application last checked just before snippet 1 expired, and starts again an hour
+	// after.
+	checkpoints := &memoryCheckpoints{times: map[string]time.Time{
+		expiredCheckpoint: expires.Add(-time.Minute)}}
+	app.checkpoints = checkpoints
+	clock := newFakeClock(expires.Add(time.Hour))
+
+	w := newExpiryWatcher(app, time.Minute)
+	w.clock = clock
+	w.Start()
+
+	clock.wait(t)
+	if got := events.take(); len(got) != 1 || got[0] != "snippet.expired 1" {
+		t.Errorf("want events %q; got %q", []string{"snippet.expired 1"}, got)
+	}
+	want := expires.Add(time.Hour).UTC().Truncate(time.Second)
+	if got, _ := checkpoints.Get(expiredCheckpoint); !got.Equal(want) {
+		t.Errorf("want checkpoint %v; got %v", want, got)
+	}
+
+	// Later checks carry on from the checkpoint.
+	clock.Advance(time.Minute)
+	clock.wait(t)
+	if got := events.take(); len(got) != 0 {
+		t.Errorf("want no events; got %q", got)
+	}
+	if got, _ := checkpoints.Get(expiredCheckpoint); !got.Equal(want.Add(time.Minute)) {
+		t.Errorf("want checkpoint %v; got %v", want.Add(time.Minute), got)
+	}
+
+	w.Stop()
+}
+
+// TestRawSnippet tests that the raw and download endpoints send just the content of a
+// snippet, with the same visibility rules as the snippet's page.
+func TestRawSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantType        string
+		wantDisposition string
+		wantBody        []byte
+	}{
+		{"Raw by ID", "/snippet/1/raw", http.StatusOK, "text/plain; charset=utf-8", "",
+			[]byte("An old silent pond...")},
+		{"Raw by slug", "/s/anOldSilentPond0000001/raw", http.StatusOK,
+			"text/plain; charset=utf-8", "", []byte("An old silent pond...")},
+		{"Raw unlisted by slug", "/s/bobsUnlistedSnippetSlg/raw", http.StatusOK,
+			"text/plain; charset=utf-8", "", []byte("Bob's unlisted snippet...")},
+		{"Raw Markdown is unrendered", "/s/onboardingNotes0000007/raw", http.StatusOK,
+			"text/plain; charset=utf-8", "", []byte("<script>alert(1)</script>")},
+		{"Download", "/snippet/1/download", http.StatusOK, "application/octet-stream",
+			`attachment; filename=an-old-silent-pond.txt`, []byte("An old silent pond...")},
+		{"Download Markdown", "/s/onboardingNotes0000007/download", http.StatusOK,
+			"application/octet-stream", `attachment; filename=onboarding-notes.md`, nil},
+		{"Raw private", "/snippet/4/raw", http.StatusNotFound, "", "", nil},
+		{"Raw private by slug", "/s/bobsPrivateSnippet0004/raw", http.StatusNotFound, "", "",
+			nil},
+		{"Raw unlisted by ID", "/snippet/5/raw", http.StatusNotFound, "", "", nil},
+		{"Download private", "/snippet/4/download", http.StatusNotFound, "", "", nil},
+		{"Non-existent ID", "/snippet/2/raw", http.StatusNotFound, "", "", nil},
+		{"Non-existent slug", "/s/foo/download", http.StatusNotFound, "", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if tt.wantType != "" && header.Get("Content-Type") != tt.wantType {
+				t.Errorf("want Content-Type %q; got %q", tt.wantType, header.Get("Content-Type"))
+			}
+
+			if cd := header.Get("Content-Disposition"); cd != tt.wantDisposition {
+				t.Errorf("want Content-Disposition %q; got %q", tt.wantDisposition, cd)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestEmbedSnippet tests that public snippets can be embedded in other sites, and that
+// framing is only allowed on the embed page's route.
+func TestEmbedSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Embeds are served without the session, so even the author can't embed their private
+	// snippets.
+	ts.login(t)
+
+	tests := []struct {
+		name          string
+		urlPath       string
+		wantCode      int
+		wantType      string
+		wantFraming   bool
+		wantBody      []string
+		forbiddenBody []string
+	}{
+		{"Embed", "/snippet/1/embed", http.StatusOK, "text/html; charset=utf-8", true,
+			[]string{"<strong>An old silent pond</strong>", `<base target="_blank">`,
+				`href="/s/anOldSilentPond0000001"`},
+			[]string{"<nav>", "csrf_token"}},
+		{"Embed Markdown", "/snippet/7/embed", http.StatusOK, "text/html; charset=utf-8", true,
+			[]string{"<h1>Onboarding</h1>"}, []string{"<script>alert(1)</script>"}},
+		{"Script", "/snippet/1/embed.js", http.StatusOK, "application/javascript; charset=utf-8",
+			false, []string{`frame.src = "https://snippetbox.example.com/snippet/1/embed";`,
+				`frame.title = "An old silent pond";`}, nil},
+		{"Own private", "/snippet/6/embed", http.StatusNotFound, "", true, nil, nil},
+		{"Own private script", "/snippet/6/embed.js", http.StatusNotFound, "", false, nil, nil},
+		{"Unlisted", "/snippet/5/embed", http.StatusNotFound, "", true, nil, nil},
+		{"Non-existent", "/snippet/2/embed", http.StatusNotFound, "", true, nil, nil},
+		{"Snippet page", "/s/anOldSilentPond0000001", http.StatusOK, "", false, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Fatalf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if tt.wantType != "" && header.Get("Content-Type") != tt.wantType {
+				t.Errorf("want Content-Type %q; got %q", tt.wantType, header.Get("Content-Type"))
+			}
+
+			frameOptions := header.Get("X-Frame-Options")
+			if tt.wantFraming && frameOptions != "" {
+				t.Errorf("want no X-Frame-Options; got %q", frameOptions)
+			} else if !tt.wantFraming && frameOptions != "deny" {
+				t.Errorf("want X-Frame-Options %q; got %q", "deny", frameOptions)
+			}
+
+			for _, want := range tt.wantBody {
+				if !bytes.Contains(body, []byte(want)) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+			for _, forbidden := range tt.forbiddenBody {
+				if bytes.Contains(body, []byte(forbidden)) {
+					t.Errorf("want body not to contain %q", forbidden)
+				}
+			}
+		})
+	}
+}
+
+// TestBurnAfterReading tests that other people can only see a burn-after-reading snippet by
+// confirming that they want to use up a view, and that its content isn't served anywhere
+// else, while its author can see it freely.
+func TestBurnAfterReading(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	events := app.events.(*recordingNotifier)
+
+	const page = "/s/bobsSecretSnippet00008"
+
+	t.Run("Confirmation page", func(t *testing.T) {
+		code, header, body := ts.get(t, page)
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+		if got := header.Get("Cache-Control"); got != "no-store" {
+			t.Errorf("want Cache-Control %q; got %q", "no-store", got)
+		}
+		for _, want := range []string{`action="/s/bobsSecretSnippet00008/reveal"`,
+			"Views left: <strong>1</strong>"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("want body to contain %q", want)
+			}
+		}
+		if bytes.Contains(body, []byte("Bob&#39;s secret snippet")) {
+			t.Error("want body not to contain the snippet")
+		}
+	})
+
+	for _, urlPath := range []string{
+		page + "/raw",
+		page + "/download",
+		"/snippet/8",
+		"/snippet/8/raw",
+		"/snippet/8/history",
+		"/snippet/8/embed",
+		"/snippet/8/embed.js",
+		"/api/v1/snippets/8",
+	} {
+		t.Run(urlPath, func(t *testing.T) {
+			if code, _, _ := ts.get(t, urlPath); code != http.StatusNotFound {
+				t.Errorf("want %d; got %d", http.StatusNotFound, code)
+			}
+		})
+	}
+
+	t.Run("Reveal", func(t *testing.T) {
+		_, _, body := ts.get(t, page)
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, header, body := ts.postForm(t, page+"/reveal", form)
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+		if got := header.Get("Cache-Control"); got != "no-store" {
+			t.Errorf("want Cache-Control %q; got %q", "no-store", got)
+		}
+		for _, want := range []string{"Bob&#39;s secret snippet...", "has now been deleted"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("want body to contain %q", want)
+			}
+		}
+		if bytes.Contains(body, []byte(page+"/raw")) {
+			t.Error("want no link to the raw content")
+		}
+
+		if got := events.take(); len(got) != 1 || got[0] != "snippet.deleted 8" {
+			t.Errorf("want a %q event; got %q", "snippet.deleted 8", got)
+		}
+	})
+
+	t.Run("Reveal without CSRF token", func(t *testing.T) {
+		if code, _, _ := ts.postForm(t, page+"/reveal", url.Values{}); code != http.StatusBadRequest {
+			t.Errorf("want %d; got %d", http.StatusBadRequest, code)
+		}
+	})
+
+	ts.login(t)
+
+	t.Run("Author", func(t *testing.T) {
+		code, _, body := ts.get(t, "/s/alicesSecretSnippet009")
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+		for _, want := range []string{"Alice&#39;s secret snippet...",
+			"views left before this snippet is deleted: 3."} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("want body to contain %q", want)
+			}
+		}
+
+		if code, _, _ := ts.get(t, "/snippet/9/raw"); code != http.StatusOK {
+			t.Errorf("want raw content %d; got %d", http.StatusOK, code)
+		}
+
+		// The author doesn't use up a view by revealing their own snippet.
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, header, _ := ts.postForm(t, "/s/alicesSecretSnippet009/reveal", form)
+		if code != http.StatusSeeOther {
+			t.Errorf("want %d; got %d", http.StatusSeeOther, code)
+		}
+		if loc := header.Get("Location"); loc != "/s/alicesSecretSnippet009" {
+			t.Errorf("want Location %q; got %q", "/s/alicesSecretSnippet009", loc)
+		}
+		if got := events.take(); len(got) != 0 {
+			t.Errorf("want no events; got %q", got)
+		}
+	})
+}
+
+// TestPasswordProtectedSnippet tests that a password-protected snippet has to be unlocked
+// before anyone but its author can see it, and that it stays unlocked for the session.
+func TestPasswordProtectedSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const page = "/s/bobsProtectedSnippet10"
+	content := []byte("Bob&#39;s protected snippet...")
+
+	// unlock submits the unlock form with the given password.
+	unlock := func(t *testing.T, password string) (int, http.Header, []byte) {
+		_, _, body := ts.get(t, page)
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		form.Add("password", password)
+		return ts.postForm(t, page+"/unlock", form)
+	}
+
+	t.Run("Locked", func(t *testing.T) {
+		code, _, body := ts.get(t, page)
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+		if !bytes.Contains(body, []byte(`action="/s/bobsProtectedSnippet10/unlock"`)) {
+			t.Error("want the unlock form")
+		}
+		if bytes.Contains(body, content) {
+			t.Error("want body not to contain the snippet")
+		}
+
+		for _, urlPath := range []string{page + "/raw", page + "/download", "/snippet/10/raw",
+			"/snippet/10/history", "/snippet/10/embed", "/snippet/10/embed.js",
+			"/api/v1/snippets/10"} {
+			if code, _, _ := ts.get(t, urlPath); code != http.StatusNotFound {
+				t.Errorf("%s: want %d; got %d", urlPath, http.StatusNotFound, code)
+			}
+		}
+
+		code, _, _ = ts.do(t, http.MethodGet, "/snippet/10", nil, func(r *http.Request) {
+			r.Header.Set("Accept", "application/json")
+		})
+		if code != http.StatusNotFound {
+			t.Errorf("want JSON %d; got %d", http.StatusNotFound, code)
+		}
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		code, _, body := unlock(t, "wrong password")
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+		if !bytes.Contains(body, []byte("Password is incorrect")) || bytes.Contains(body, content) {
+			t.Errorf("want the form with an error and without the snippet; got %q", body)
+		}
+	})
+
+	t.Run("Right password", func(t *testing.T) {
+		code, header, _ := unlock(t, mock.MockSnippetPassword)
+		if code != http.StatusSeeOther {
+			t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+		}
+		if loc := header.Get("Location"); loc != page {
+			t.Errorf("want Location %q; got %q", page, loc)
+		}
+
+		// The snippet stays unlocked for the rest of the session.
+		code, _, body := ts.get(t, page)
+		if code != http.StatusOK || !bytes.Contains(body, content) {
+			t.Errorf("want %d with the snippet; got %d", http.StatusOK, code)
+		}
+		if code, _, _ := ts.get(t, page+"/raw"); code != http.StatusOK {
+			t.Errorf("want raw content %d; got %d", http.StatusOK, code)
+		}
+	})
+}
+
+// TestUnlockThrottling tests that guessing a snippet's password is refused after too many
+// wrong guesses, even if the next guess is right.
+func TestUnlockThrottling(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const page = "/s/bobsProtectedSnippet10"
+	_, _, body := ts.get(t, page)
+	csrfToken := extractCSRFToken(t, body)
+
+	for i := 1; i <= 6; i++ {
+		password := "wrong password"
+		want := "Password is incorrect"
+		if i == 6 {
+			password = mock.MockSnippetPassword
+			want = "Too many incorrect passwords"
+		}
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		form.Add("password", password)
+		code, _, body := ts.postForm(t, page+"/unlock", form)
+		if code != http.StatusOK || !bytes.Contains(body, []byte(want)) {
+			t.Fatalf("attempt %d: want %d with %q; got %d", i, http.StatusOK, want, code)
+		}
+	}
+}
+
+// slowPasswords makes checking snippet passwords slow, like bcrypt is, so that guesses sent
+// together are all being checked at the same time.
+type slowPasswords struct {
+	*mock.SnippetModel
+}
+
+func (m slowPasswords) CheckPassword(id int, password string) error {
+	time.Sleep(50 * time.Millisecond)
+	return m.SnippetModel.CheckPassword(id, password)
+}
+
+// TestUnlockThrottlingConcurrent tests that wrong guesses sent at the same time can't get
+// past the limit while the first ones are still being checked.
+func TestUnlockThrottlingConcurrent(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	app.snippets = slowPasswords{&mock.SnippetModel{}}
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const page = "/s/bobsProtectedSnippet10"
+	_, _, body := ts.get(t, page)
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	form.Add("password", "wrong password")
+
+	const guesses = 20
+	bodies := make(chan []byte, guesses)
+	errs := make(chan error, guesses)
+	for i := 0; i < guesses; i++ {
+		go func() {
+			rs, err := ts.Client().PostForm(ts.URL+page+"/unlock", form)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer rs.Body.Close()
+			b, err := io.ReadAll(rs.Body)
+			if err != nil {
+				errs <- err
+				return
+			}
+			bodies <- b
+		}()
+	}
+
+	checked := 0
+	for i := 0; i < guesses; i++ {
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		case b := <-bodies:
+			if bytes.Contains(b, []byte("Password is incorrect")) {
+				checked++
+			} else if !bytes.Contains(b, []byte("Too many incorrect passwords")) {
+				t.Fatalf("want the form with an error; got %q", b)
+			}
+		}
+	}
+	if checked != unlockClientAttempts {
+		t.Errorf("want %d guesses checked; got %d", unlockClientAttempts, checked)
+	}
+}
+
+// TestEncryptedSnippet tests that encrypted snippets are stored as plain text ciphertext, and
+// that their pages leave the ciphertext for main.js to decrypt.
+func TestEncryptedSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Form", func(t *testing.T) {
+		values := validSnippetForm()
+		values.Set("encrypted", "true")
+		values.Set("content", "q83vEjRWeJCrze8SNFZ4kKvN7xI0VniQ")
+		values.Set("language", "go")
+		values.Set("format", "markdown")
+		form := forms.NewForm(values)
+		validateSnippetForm(form, nil)
+		if !form.Valid() {
+			t.Fatalf("want a valid form; got errors %v", form.FormErrors)
+		}
+
+		s := formSnippet(form)
+		if !s.Encrypted || s.Language != "text" || s.Format != models.FormatPlain {
+			t.Errorf("want an encrypted plain text snippet; got encrypted %t, language %q and "+
+				"format %q", s.Encrypted, s.Language, s.Format)
+		}
+	})
+
+	t.Run("Show", func(t *testing.T) {
+		code, _, body := ts.get(t, "/s/bobsEncryptedSnippet11")
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+		for _, want := range []string{`data-ciphertext="q83vEjRWeJCrze8SNFZ4kKvN7xI0VniQ"`,
+			"This snippet is encrypted"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("want body to contain %q", want)
+			}
+		}
+		if bytes.Contains(body, []byte("embed-code")) {
+			t.Error("want no embed code")
+		}
+	})
+
+	for _, urlPath := range []string{"/snippet/11/embed", "/snippet/11/embed.js"} {
+		t.Run(urlPath, func(t *testing.T) {
+			if code, _, _ := ts.get(t, urlPath); code != http.StatusNotFound {
+				t.Errorf("want %d; got %d", http.StatusNotFound, code)
+			}
+		})
+	}
+}
+
+// TestSnippetFilename tests that download filenames are made safe, and fall back to the
+// snippet ID when the title has no usable characters.
+func TestSnippetFilename(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		snippet *models.Snippet
+		want    string
+	}{
+		{"Code", &models.Snippet{Title: "Deploy script", Language: "bash"}, "deploy-script.sh"},
+		{"Markdown", &models.Snippet{Title: "Notes", Format: models.FormatMarkdown},
+			"notes.md"},
+		{"Unsafe characters", &models.Snippet{Title: `../../etc/"passwd"`, Language: "text"},
+			"etc-passwd.txt"},
+		{"No usable characters", &models.Snippet{ID: 42, Title: "日本語"}, "snippet-42.txt"},
+		{"Long title", &models.Snippet{Title: strings.Repeat("ab ", 30), Language: "go"},
+			strings.Repeat("ab-", 16) + "ab.go"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := snippetFilename(tt.snippet); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestContentNegotiation tests that the home page and snippet pages send JSON or plain text
+// instead of HTML when the client prefers it.
+func TestContentNegotiation(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		accept   string
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{"Home HTML", "/", "text/html,*/*;q=0.8", http.StatusOK, "text/html; charset=utf-8",
+			"<h2>Latest Snippets"},
+		{"Home no Accept", "/", "", http.StatusOK, "text/html; charset=utf-8",
+			"<h2>Latest Snippets"},
+		{"Home JSON", "/", "application/json", http.StatusOK, "application/json",
+			`"slug": "anOldSilentPond0000001"`},
+		{"Home plain text", "/", "text/plain", http.StatusOK, "text/plain; charset=utf-8",
+			"/s/anOldSilentPond0000001\tAn old silent pond\n"},
+		{"Home unsupported", "/", "image/png", http.StatusOK, "text/html; charset=utf-8",
+			"<h2>Latest Snippets"},
+		{"Snippet JSON", "/s/anOldSilentPond0000001", "application/json", http.StatusOK,
+			"application/json", `"title": "An old silent pond"`},
+		{"Snippet plain text", "/s/anOldSilentPond0000001", "text/plain", http.StatusOK,
+			"text/plain; charset=utf-8", "An old silent pond..."},
+		{"Snippet by ID HTML", "/snippet/1", "text/html", http.StatusFound, "", ""},
+		{"Snippet by ID JSON", "/snippet/1", "application/json", http.StatusOK,
+			"application/json", `"id": 1`},
+		{"Snippet by ID plain text", "/snippet/1", "text/plain;q=0.9, text/html;q=0.5",
+			http.StatusOK, "text/plain; charset=utf-8", "An old silent pond..."},
+		{"Private snippet JSON", "/snippet/4", "application/json", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.do(t, http.MethodGet, tt.urlPath, nil,
+				func(r *http.Request) {
+					r.Header.Set("Accept", tt.accept)
+				})
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			vary := strings.Join(header.Values("Vary"), ", ")
+			if code != http.StatusNotFound && !strings.Contains(vary, "Accept") {
+				t.Errorf("want Vary to contain %q; got %q", "Accept", vary)
+			}
+
+			if ct := header.Get("Content-Type"); tt.wantType != "" && ct != tt.wantType {
+				t.Errorf("want Content-Type %q; got %q", tt.wantType, ct)
+			}
+
+			if !bytes.Contains(body, []byte(tt.wantBody)) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestNegotiate tests that negotiate picks the offer the Accept header prefers.
+func TestNegotiate(t *testing.T) {
+	offers := []string{"text/html", "application/json", "text/plain"}
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"Empty", "", "text/html"},
+		{"Anything", "*/*", "text/html"},
+		{"Exact", "application/json", "application/json"},
+		{"Quality", "text/html;q=0.5, application/json", "application/json"},
+		{"Wildcard subtype", "text/*", "text/html"},
+		{"Specific beats wildcard", "text/*;q=0.5, text/plain", "text/plain"},
+		{"Excluded", "text/html;q=0, */*", "application/json"},
+		{"Browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"text/html"},
+		{"Unsupported", "image/png", ""},
+		{"Malformed", "text/plain;;", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiate(tt.accept, offers...); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestSnippetHistory tests that the history page lists a snippet's revisions and shows a diff
+// between the chosen revisions.
+func TestSnippetHistory(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Note that html/template escapes the "+" prefix of inserted lines as "&#43;".
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Default diff", "/snippet/1/history", http.StatusOK,
+			[]byte(`<span class="diff-insert">&#43;An old silent pond...</span>`)},
+		{"Chosen revisions", "/snippet/1/history?from=2&to=1", http.StatusOK,
+			[]byte(`<span class="diff-insert">&#43;An old pond...</span>`)},
+		{"Identical revisions", "/snippet/1/history?from=1&to=1", http.StatusOK,
+			[]byte("The content of these revisions is identical.")},
+		{"Unknown revision", "/snippet/1/history?from=99", http.StatusBadRequest, nil},
+		{"Non-existent ID", "/snippet/2/history", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
 }
 
 // TestSignupUser tests that signupUser handler returns appropriate status codes and error messages
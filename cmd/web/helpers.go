@@ -2,11 +2,21 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"regexp"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/DataDavD/snippetbox/pkg/forms"
+	"github.com/DataDavD/snippetbox/pkg/models"
 	"github.com/justinas/nosurf"
 )
 
@@ -36,6 +46,73 @@ func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
 
+// apiError is the JSON body of error responses from the API. Fields holds the validation
+// errors for each field of the request, if there were any.
+type apiError struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// writeJSON sends v encoded as JSON, with the given status code.
+func (app *application) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	js, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(append(js, '\n')); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// apiServerError is the JSON equivalent of serverError. It logs the error and stack trace,
+// then sends a generic 500 Internal Server Error response.
+func (app *application) apiServerError(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	if err := app.errorLog.Output(2, trace); err != nil {
+		app.errorLog.Println("issue with printing error logs", err)
+	}
+
+	app.apiClientError(w, http.StatusInternalServerError)
+}
+
+// apiClientError is the JSON equivalent of clientError. It sends the status code with its
+// description as the error message.
+func (app *application) apiClientError(w http.ResponseWriter, status int) {
+	app.writeJSON(w, status, &apiError{Error: http.StatusText(status)})
+}
+
+// apiNotFound is the JSON equivalent of notFound.
+func (app *application) apiNotFound(w http.ResponseWriter) {
+	app.apiClientError(w, http.StatusNotFound)
+}
+
+// apiUnauthorized sends a 401 Unauthorized response, telling the client to authenticate
+// with an API token.
+func (app *application) apiUnauthorized(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="snippetbox"`)
+	app.apiClientError(w, http.StatusUnauthorized)
+}
+
+// apiUnauthorizedBasic sends a 401 Unauthorized response, telling the client to authenticate
+// with HTTP Basic authentication, which is only used to create API tokens.
+func (app *application) apiUnauthorizedBasic(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `Basic realm="snippetbox", charset="UTF-8"`)
+	app.apiClientError(w, http.StatusUnauthorized)
+}
+
+// apiValidationError sends a 422 Unprocessable Entity response listing the validation
+// errors of the form.
+func (app *application) apiValidationError(w http.ResponseWriter, form *forms.Form) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, &apiError{
+		Error:  http.StatusText(http.StatusUnprocessableEntity),
+		Fields: form.FormErrors,
+	})
+}
+
 // addDefaultData takes a pointer to a templateData struct
 // and adds the current year to the CurrentYear field, as well as the Flash message,
 // and then returns the pointer. Note, we're not using the *http.Request parameter at the
@@ -47,11 +124,19 @@ func (app *application) addDefaultData(td *templateData, r *http.Request) *templ
 	td.CurrentYear = time.Now().Year()
 	td.Flash = app.session.PopString(r, "flash")
 	td.IsAuthenticated = app.isAuthenticated(r)
+	td.AuthenticatedUserID = app.authenticatedUserID(r)
 	td.CSRFToken = nosurf.Token(r)
 	return td
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, name string, td *templateData) {
+	app.renderTemplate(w, name, app.addDefaultData(td, r))
+}
+
+// renderTemplate renders a page without adding the default data. Most handlers should use
+// render instead; this is for pages served without the session, like embedded snippets,
+// where there's no flash message, user or CSRF token to add.
+func (app *application) renderTemplate(w http.ResponseWriter, name string, td *templateData) {
 	// Retrieve the appropriate template set from the cache based on the page name
 	// (like 'home.page.gohtml'). If no entry exists in the cache with the provided name,
 	// call the serverError helper method.
@@ -66,7 +151,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, name stri
 
 	// Write the template to the buffer, instead of straight to the http.ResponseWriter.
 	// If there is an error, call our serverError helper and then return.
-	err := ts.Execute(buff, app.addDefaultData(td, r))
+	err := ts.Execute(buff, td)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -80,6 +165,98 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, name stri
 	}
 }
 
+// representations holds the different forms a handler can send a resource in. HTML is
+// rendered from a page template, and is always available. JSON and Text are optional; a
+// nil JSON value or an empty Text means the handler doesn't offer that representation.
+type representations struct {
+	Page string
+	Data *templateData
+	JSON interface{}
+	Text string
+}
+
+// respond is the content negotiating equivalent of render. It sends whichever of the
+// handler's representations the client prefers, according to its Accept header, so that a
+// single handler can serve browsers, scripts and API clients. Browsers, clients which don't
+// say what they accept, and clients which accept none of the representations get HTML.
+func (app *application) respond(w http.ResponseWriter, r *http.Request, reps *representations) {
+	// The response depends on the Accept header, so caches must key on it too.
+	w.Header().Add("Vary", "Accept")
+
+	offers := []string{"text/html"}
+	if reps.JSON != nil {
+		offers = append(offers, "application/json")
+	}
+	if reps.Text != "" {
+		offers = append(offers, "text/plain")
+	}
+
+	switch negotiate(r.Header.Get("Accept"), offers...) {
+	case "application/json":
+		app.writeJSON(w, http.StatusOK, reps.JSON)
+	case "text/plain":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if _, err := io.WriteString(w, reps.Text); err != nil {
+			app.errorLog.Println(err)
+		}
+	default:
+		app.render(w, r, reps.Page, reps.Data)
+	}
+}
+
+// negotiate returns the media type from offers which is most preferred by the given Accept
+// header, using the quality ("q") values and the most specific matching media range. Ties
+// go to the earliest offer, as does an empty Accept header. If none of the offers are
+// acceptable, negotiate returns the empty string.
+func negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// Find the quality of the most specific media range which matches the offer. An
+		// exact match beats "type/*", which beats "*/*".
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			var s int
+			switch {
+			case mediaRange == offer:
+				s = 2
+			case strings.HasSuffix(mediaRange, "/*") &&
+				strings.HasPrefix(offer, strings.TrimSuffix(mediaRange, "*")):
+				s = 1
+			case mediaRange == "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+
+			specificity, q = s, 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					q = 0
+				}
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
 func (app *application) isAuthenticated(r *http.Request) bool {
 	isAuthenticated, ok := r.Context().Value(contextKeyIsAuthenticated).(bool)
 	if !ok {
@@ -87,3 +264,91 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// authenticatedUserID returns the ID of the currently logged-in user, or 0 if the
+// request is not authenticated. The ID is added to the request context by the
+// authentication middleware, so this works for both browser sessions and API requests.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+	id, _ := r.Context().Value(contextKeyUserID).(int)
+	return id
+}
+
+// clientIP returns the IP address of the client which sent the request, without the port.
+// The application is served directly rather than through a proxy, so the connection's
+// remote address is the client's.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientNetwork returns the network of the client which sent the request, for throttling:
+// its IP address if it's an IPv4 client, or its /64 network if it's an IPv6 client, since
+// those are usually given a whole /64 to pick addresses from.
+func clientNetwork(r *http.Request) string {
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil || ip.To4() != nil {
+		return clientIP(r)
+	}
+	mask := net.CIDRMask(64, 128)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// formatCursor encodes the position of snippet s in a listing as a string suitable for use in
+// a URL, in the form "<created unix nanoseconds>-<id>".
+func formatCursor(s *models.Snippet) string {
+	return fmt.Sprintf("%d-%d", s.Created.UnixNano(), s.ID)
+}
+
+// parseCursor decodes a cursor string created by formatCursor.
+func parseCursor(value string, backward bool) (*models.Cursor, error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed cursor")
+	}
+
+	nsec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil || id < 1 {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return &models.Cursor{Created: time.Unix(0, nsec).UTC(), ID: id, Backward: backward}, nil
+}
+
+// filenameRX matches runs of characters which aren't safe to use in a filename.
+var filenameRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// snippetFilename returns the filename to use when downloading a snippet. It's based on the
+// snippet's title, with an extension for its language or format.
+func snippetFilename(s *models.Snippet) string {
+	name := strings.Trim(filenameRX.ReplaceAllString(strings.ToLower(s.Title), "-"), "-")
+	if len(name) > 50 {
+		name = strings.TrimRight(name[:50], "-")
+	}
+	if name == "" {
+		name = fmt.Sprintf("snippet-%d", s.ID)
+	}
+
+	ext := ".txt"
+	if s.Format == models.FormatMarkdown {
+		ext = ".md"
+	} else {
+		for _, l := range languages {
+			if l.Value == s.Language {
+				ext = l.Ext
+			}
+		}
+	}
+
+	return name + ext
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/DataDavD/snippetbox/pkg/models"
@@ -16,27 +21,75 @@ import (
 	"github.com/golangcollege/sessions"
 
 	"github.com/DataDavD/snippetbox/pkg/models/mysql"
+	"github.com/DataDavD/snippetbox/pkg/webhook"
 )
 
 type contextKey string
 
 const contextKeyIsAuthenticated = contextKey("isAuthenticated")
 
+// contextKeyUserID is the request context key holding the ID of the authenticated user.
+const contextKeyUserID = contextKey("userID")
+
 type application struct {
+	// baseURL is the absolute URL the application is served at, without a trailing slash,
+	// for the links in feeds and embeds. It's configured rather than taken from the Host
+	// header, which the client controls.
+	baseURL string
+	// checkpoints records how far background jobs have got.
+	checkpoints interface {
+		Get(string) (time.Time, error)
+		Set(string, time.Time) error
+	}
 	errorLog *log.Logger
-	infoLog  *log.Logger
-	session  *sessions.Session
-	snippets interface {
-		Insert(string, string, string) (int, error)
+	// events sends webhook events about snippets. It's a *webhook.Dispatcher, which delivers
+	// events in the background.
+	events interface {
+		Notify(string, *models.Snippet)
+	}
+	infoLog *log.Logger
+	// loginAttempts throttles guessing passwords through the API.
+	loginAttempts *attemptLimiter
+	session       *sessions.Session
+	snippets      interface {
+		Insert(*models.Snippet) (int, string, error)
+		Update(*models.Snippet) error
+		Delete(int, int) error
 		Get(int) (*models.Snippet, error)
+		GetBySlug(string) (*models.Snippet, error)
+		View(int) (*models.Snippet, error)
+		CheckPassword(int, string) error
 		Latest() ([]*models.Snippet, error)
+		ByUser(int, int) ([]*models.Snippet, error)
+		Page(*models.Cursor, int, int) ([]*models.Snippet, int, error)
+		Search(string, int, int) ([]*models.Snippet, error)
+		SetTags(int, []string) error
+		Tagged(string, int) ([]*models.Snippet, error)
+		Tags() ([]string, error)
+		Revisions(int) ([]*models.Revision, error)
+		Expired(time.Time, time.Time) ([]*models.Snippet, error)
 	}
 	templateCache map[string]*template.Template
-	users         interface {
+	tokens        interface {
+		Insert(int, string, time.Time) (string, error)
+		List(int) ([]*models.Token, error)
+		Revoke(int, int) error
+		Authenticate(string) (int, error)
+	}
+	// unlockAttempts throttles guessing the passwords of password-protected snippets.
+	unlockAttempts *attemptLimiter
+	users          interface {
 		Insert(string, string, string) error
 		Authenticate(string, string) (int, error)
 		Get(int) (*models.User, error)
 	}
+	webhooks interface {
+		Insert(*models.Webhook) (int, error)
+		Get(int, int) (*models.Webhook, error)
+		List(int) ([]*models.Webhook, error)
+		Delete(int, int) error
+		Deliveries(int, int) ([]*models.Delivery, error)
+	}
 }
 
 func main() {
@@ -49,9 +102,17 @@ func main() {
 
 	addr := flag.String("addr", ":4000", "HTTP network address")
 	dsn := flag.String("dsn", pw, "MySQL data source name")
+	baseURL := flag.String("base-url", "https://localhost:4000",
+		"Absolute URL the application is served at, for links in feeds and embeds")
 	// Define a new command-line flag for the session secrete (a random key which will be
 	// used to encrypt and authenticate session cookies). It should be 32 bytes long.
 	secret := flag.String("secret", "s6Ndh+pPbnzHbS*+9Pk8qGWhTzbpa@ge", "Secret key")
+	// Expired snippets are deleted by a background job every purge-interval, once they've
+	// been expired for longer than purge-grace.
+	purgeInterval := flag.Duration("purge-interval", time.Hour,
+		"Time between purges of expired snippets")
+	purgeGrace := flag.Duration("purge-grace", 24*time.Hour,
+		"How long snippets are kept after they expire")
 	flag.Parse()
 
 	// To keep the main() func tidy we've put the code for creating a connection pool into separate
@@ -79,16 +140,52 @@ func main() {
 	session.Lifetime = 12 * time.Hour
 	session.Secure = true // Set the Secure flag on our session cookies to true
 
+	// Start the webhook dispatcher, which delivers events to webhooks from a pool of
+	// background workers.
+	webhooks := &mysql.WebhookModel{DB: db}
+	dispatcher := webhook.New(webhooks, errorLog)
+	dispatcher.Start(4)
+	defer dispatcher.Stop()
+
+	snippets := &mysql.SnippetModel{DB: db}
+
+	// Sweep away the unlock and API login attempts which are too old to count, every 15
+	// minutes.
+	unlockAttempts := newAttemptLimiter(15 * time.Minute)
+	unlockAttempts.Start()
+	defer unlockAttempts.Stop()
+	loginAttempts := newAttemptLimiter(15 * time.Minute)
+	loginAttempts.Start()
+	defer loginAttempts.Stop()
+
 	// And add the session manager to our application dependencies.
 	app := &application{
-		errorLog:      errorLog,
-		infoLog:       infoLog,
-		session:       session,
-		snippets:      &mysql.SnippetModel{DB: db},
-		templateCache: templateCache,
-		users:         &mysql.UserModel{DB: db},
+		baseURL:        strings.TrimSuffix(*baseURL, "/"),
+		checkpoints:    &mysql.CheckpointModel{DB: db},
+		errorLog:       errorLog,
+		events:         dispatcher,
+		infoLog:        infoLog,
+		loginAttempts:  loginAttempts,
+		session:        session,
+		snippets:       snippets,
+		templateCache:  templateCache,
+		tokens:         &mysql.TokenModel{DB: db},
+		unlockAttempts: unlockAttempts,
+		users:          &mysql.UserModel{DB: db},
+		webhooks:       webhooks,
 	}
 
+	// Snippets aren't deleted as soon as they expire, so watch for them to send webhook
+	// events.
+	watcher := newExpiryWatcher(app, time.Minute)
+	watcher.Start()
+	defer watcher.Stop()
+
+	// Start the purger, which deletes snippets from the database some time after they expire.
+	purger := newPurger(snippets, *purgeInterval, *purgeGrace, infoLog, errorLog)
+	purger.Start()
+	defer purger.Stop()
+
 	// Initialize a tls.Config struct to hold the non-default TLS settings we want the server to
 	// use.
 	tlsConfig := &tls.Config{
@@ -108,12 +205,33 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// Shut the server down gracefully on an interrupt or termination signal, letting the
+	// requests in progress finish. Once ListenAndServeTLS() returns, main() returns too, and
+	// the deferred calls stop the background jobs and close the database.
+	shutdownErr := make(chan error)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		sig := <-quit
+
+		infoLog.Printf("Shutting down server (%s)", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
 	infoLog.Printf("Starting server on %s", *addr)
 	// Use the ListenAndServeTLS() method to start the HTTPS server. We pass in the paths
-	// to the TLS certs and private key as the two parameters.
-	if err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem"); err != nil {
+	// to the TLS certs and private key as the two parameters. It returns
+	// http.ErrServerClosed once Shutdown() is called.
+	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	if !errors.Is(err, http.ErrServerClosed) {
 		errorLog.Fatal(err)
 	}
+	if err = <-shutdownErr; err != nil {
+		errorLog.Print(err)
+	}
+	infoLog.Print("Stopped server")
 }
 
 func openDB(dsn string) (*sql.DB, error) {
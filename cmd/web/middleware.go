@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/DataDavD/snippetbox/pkg/models"
 	"github.com/justinas/nosurf"
@@ -18,6 +20,17 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// allowFraming relaxes secureHeaders for pages which are meant to be framed by other sites,
+// like embedded snippets. It must only be used on routes which serve nothing but public
+// data, with no session, since framing is what clickjacking attacks rely on.
+func allowFraming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Del("X-Frame-Options")
+		w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
@@ -110,6 +123,114 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// context to indicate this, and call the next handler in the chain *using this new copy of
 		// the request*.
 		ctx := context.WithValue(r.Context(), contextKeyIsAuthenticated, true)
+		ctx = context.WithValue(ctx, contextKeyUserID, user.ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiLoginClientAttempts is how many times each client network may try an email address and
+// password in the window of app.loginAttempts, and apiLoginUserAttempts is how many times
+// each email address may be tried from every network together.
+const (
+	apiLoginClientAttempts = 10
+	apiLoginUserAttempts   = 10
+)
+
+// requireBasicAuth authenticates API requests with the user's email address and password,
+// sent with HTTP Basic authentication. It's only used to create API tokens, which every
+// other API request is authenticated with, so that passwords can't be guessed through the
+// rest of the API. Attempts are throttled like unlocking a snippet, and requests without
+// valid credentials are rejected.
+func (app *application) requireBasicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, password, ok := r.BasicAuth()
+		if !ok {
+			app.apiUnauthorizedBasic(w)
+			return
+		}
+
+		limits := map[string]int{
+			"login " + clientNetwork(r):       apiLoginClientAttempts,
+			"login " + strings.ToLower(email): apiLoginUserAttempts,
+		}
+		now := time.Now()
+		if !app.loginAttempts.attempt(now, limits) {
+			app.apiClientError(w, http.StatusTooManyRequests)
+			return
+		}
+
+		id, err := app.users.Authenticate(email, password)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.apiUnauthorizedBasic(w)
+			return
+		} else if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+
+		// Deactivated users can't use the API either.
+		user, err := app.users.Get(id)
+		if errors.Is(err, models.ErrNoRecord) || (err == nil && !user.Active) {
+			app.apiUnauthorizedBasic(w)
+			return
+		} else if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+
+		app.loginAttempts.succeed(now, limits)
+		ctx := context.WithValue(r.Context(), contextKeyIsAuthenticated, true)
+		ctx = context.WithValue(ctx, contextKeyUserID, user.ID)
+		w.Header().Add("Cache-Control", "no-store")
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// authenticateToken authenticates API requests which carry a personal API token in an
+// "Authorization: Bearer <token>" header. Like authenticate, it marks the request context
+// as authenticated and adds the ID of the token's owner. Requests without an Authorization
+// header carry on unauthenticated, but requests with an invalid or expired token, or with
+// any other kind of credentials, are rejected.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Other schemes, like HTTP Basic authentication with a password, aren't accepted.
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth {
+			app.apiUnauthorized(w)
+			return
+		}
+
+		id, err := app.tokens.Authenticate(token)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="snippetbox", error="invalid_token"`)
+			app.apiClientError(w, http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyIsAuthenticated, true)
+		ctx = context.WithValue(ctx, contextKeyUserID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireAPIAuth is the API equivalent of requireAuth. Rather than redirecting to the login
+// page, it sends a 401 Unauthorized response to unauthenticated requests.
+func (app *application) requireAPIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.apiUnauthorized(w)
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// clock tells the time and waits for it to pass. The purger uses a clock rather than
+// calling the time package directly, so that its tests can use a fake clock instead of
+// waiting for real time to pass.
+type clock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+// realClock is the clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// purger deletes expired snippets from the database in the background. Expired snippets are
+// already hidden by every query, but without the purger they'd stay in the snippets table
+// forever. Its settings can be changed before Start is called.
+type purger struct {
+	snippets interface {
+		DeleteExpired(time.Time, int) (int, error)
+	}
+	clock    clock
+	errorLog *log.Logger
+	infoLog  *log.Logger
+
+	// interval is the time between purges. grace is how long a snippet is kept after it
+	// expires, which should be longer than the interval of the expiry watcher, so that the
+	// webhook event for a snippet is sent before the snippet is deleted. batchSize is the
+	// most snippets deleted by a single statement.
+	interval  time.Duration
+	grace     time.Duration
+	batchSize int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newPurger returns a purger which deletes snippets more than grace after they expire, every
+// interval, 500 at a time.
+func newPurger(snippets interface {
+	DeleteExpired(time.Time, int) (int, error)
+}, interval, grace time.Duration, infoLog, errorLog *log.Logger) *purger {
+	return &purger{
+		snippets:  snippets,
+		clock:     realClock{},
+		errorLog:  errorLog,
+		infoLog:   infoLog,
+		interval:  interval,
+		grace:     grace,
+		batchSize: 500,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start starts purging in the background, first after one interval has passed.
+func (p *purger) Start() {
+	go p.run()
+}
+
+// Stop stops the purger, waiting for a purge in progress to finish its current batch.
+func (p *purger) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *purger) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.clock.After(p.interval):
+			p.purge()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// purge deletes every snippet which expired more than the grace period ago, in batches, and
+// logs how many were deleted. Errors are logged, and the snippets left are deleted by the
+// next purge.
+func (p *purger) purge() {
+	before := p.clock.Now().Add(-p.grace)
+
+	total := 0
+	for {
+		n, err := p.snippets.DeleteExpired(before, p.batchSize)
+		total += n
+		if err != nil {
+			p.errorLog.Printf("purging expired snippets: %s", err)
+			break
+		}
+		if n < p.batchSize {
+			break
+		}
+
+		// Don't hold up shutdown while there are still batches to go.
+		select {
+		case <-p.stop:
+			p.infoLog.Printf("Purged %d expired snippets before stopping", total)
+			return
+		default:
+		}
+	}
+
+	if total > 0 {
+		p.infoLog.Printf("Purged %d expired snippets", total)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose time only passes when Advance is called. Each call to After
+// is announced on the waiting channel, so that tests can wait for the code under test to
+// start waiting before advancing the clock.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiting: make(chan struct{}, 10)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	t := fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+
+	c.waiting <- struct{}{}
+	return t.c
+}
+
+// Advance moves the clock on by d, firing the timers which are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	var pending []fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// wait waits for the code under test to call After.
+func (c *fakeClock) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the clock to be waited on")
+	}
+}
+
+// fakeExpiredSnippets pretends to hold some expired snippets, and records the calls to
+// DeleteExpired.
+type fakeExpiredSnippets struct {
+	mu      sync.Mutex
+	expired int
+	err     error
+	calls   []time.Time
+}
+
+func (s *fakeExpiredSnippets) DeleteExpired(before time.Time, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, before)
+	if s.err != nil {
+		return 0, s.err
+	}
+	n := limit
+	if s.expired < n {
+		n = s.expired
+	}
+	s.expired -= n
+	return n, nil
+}
+
+func (s *fakeExpiredSnippets) take() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := s.calls
+	s.calls = nil
+	return calls
+}
+
+func TestPurger(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	clock := newFakeClock(start)
+	snippets := &fakeExpiredSnippets{expired: 5}
+	var infoLog, errorLog bytes.Buffer
+
+	p := newPurger(snippets, time.Hour, 24*time.Hour, log.New(&infoLog, "", 0),
+		log.New(&errorLog, "", 0))
+	p.clock = clock
+	p.batchSize = 2
+	p.Start()
+
+	// Nothing is purged until an interval has passed.
+	clock.wait(t)
+	clock.Advance(59 * time.Minute)
+	if calls := snippets.take(); len(calls) != 0 {
+		t.Fatalf("want no purge before the interval; got %d calls", len(calls))
+	}
+
+	// Then every snippet which expired before the grace period is deleted, in batches of
+	// two. The purger waits for the next interval once it's done.
+	clock.Advance(time.Minute)
+	clock.wait(t)
+	calls := snippets.take()
+	if len(calls) != 3 {
+		t.Fatalf("want 3 batches; got %d", len(calls))
+	}
+	want := start.Add(time.Hour - 24*time.Hour)
+	for _, before := range calls {
+		if !before.Equal(want) {
+			t.Errorf("want snippets which expired before %v deleted; got %v", want, before)
+		}
+	}
+	if got := infoLog.String(); got != "Purged 5 expired snippets\n" {
+		t.Errorf("want the count logged; got %q", got)
+	}
+
+	// Purges with nothing to delete make one call, and log nothing.
+	infoLog.Reset()
+	clock.Advance(time.Hour)
+	clock.wait(t)
+	if calls := snippets.take(); len(calls) != 1 {
+		t.Errorf("want 1 batch; got %d", len(calls))
+	}
+	if infoLog.Len() != 0 {
+		t.Errorf("want nothing logged; got %q", infoLog.String())
+	}
+
+	// Errors are logged, and the purger carries on.
+	snippets.mu.Lock()
+	snippets.err = errors.New("connection refused")
+	snippets.mu.Unlock()
+	clock.Advance(time.Hour)
+	clock.wait(t)
+	if got := errorLog.String(); got != "purging expired snippets: connection refused\n" {
+		t.Errorf("want the error logged; got %q", got)
+	}
+
+	// Stop returns once the purger has stopped, without waiting for the next interval.
+	stopped := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the purger to stop")
+	}
+}
@@ -12,6 +12,14 @@ func (app *application) routes() http.Handler {
 	// which will be used for every request our app receives.
 	standardMiddleware := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
 
+	return standardMiddleware.Then(app.router())
+}
+
+// router registers every route with its handler and route-specific middleware. It's kept
+// separate from routes so that tests can inspect the registered routes, and check them
+// against the OpenAPI document in ui/static/openapi.json. Any route added here must be
+// described there too.
+func (app *application) router() *pat.PatternServeMux {
 	// add the authenticate() middleware to the chain
 	// and use the noSurf middleware on all our dynamic routes.
 	dynamicMiddleware := alice.New(app.session.Enable, noSurf, app.authenticate)
@@ -20,17 +28,43 @@ func (app *application) routes() http.Handler {
 
 	// Health check
 	mux.Get("/healthcheck", http.HandlerFunc(app.ping))
+	mux.Get("/openapi.json", http.HandlerFunc(app.openAPISpec))
 
 	// Register exact matches before wildcard route match (i.e. :id in Get method for
 	// '/snippet/create').
 	// Update these routes to use the dynamic middleware chain follow by the appropriate handler
 	// function.
 	mux.Get("/", dynamicMiddleware.ThenFunc(app.home))
+	mux.Get("/snippets", dynamicMiddleware.ThenFunc(app.browseSnippets))
+	mux.Get("/search", dynamicMiddleware.ThenFunc(app.searchSnippets))
+	mux.Get("/tag/:name", dynamicMiddleware.ThenFunc(app.tagSnippets))
+	// Feeds are fetched by feed readers, which have no session, so they don't use the dynamic
+	// middleware. They only ever contain listed snippets.
+	mux.Get("/feed.atom", http.HandlerFunc(app.atomFeed))
+	mux.Get("/feed.rss", http.HandlerFunc(app.rssFeed))
+	mux.Get("/user/:id/feed.atom", http.HandlerFunc(app.userAtomFeed))
+	mux.Get("/user/:id/feed.rss", http.HandlerFunc(app.userRSSFeed))
 	// Require auth middleware for auth'd/logged-in actions
 	mux.Get("/snippet/create", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.createSnippetForm))
 	mux.Get("/snippet/:id", dynamicMiddleware.ThenFunc(app.showSnippet))
 	// Require auth middleware for auth'd/logged-in actions
 	mux.Post("/snippet/create", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.createSnippet))
+	mux.Get("/snippet/:id/edit", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.editSnippetForm))
+	mux.Post("/snippet/:id/edit", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.editSnippet))
+	mux.Get("/snippet/:id/history", dynamicMiddleware.ThenFunc(app.snippetHistory))
+	mux.Get("/snippet/:id/raw", dynamicMiddleware.ThenFunc(app.rawSnippet))
+	mux.Get("/snippet/:id/download", dynamicMiddleware.ThenFunc(app.downloadSnippet))
+	// Embedded snippets are framed by other sites, so they're served without the session
+	// (and so without CSRF protection, which they don't need) and with framing allowed.
+	mux.Get("/snippet/:id/embed", allowFraming(http.HandlerFunc(app.embedSnippet)))
+	mux.Get("/snippet/:id/embed.js", http.HandlerFunc(app.embedSnippetScript))
+	mux.Get("/s/:slug", dynamicMiddleware.ThenFunc(app.showSnippetBySlug))
+	mux.Get("/s/:slug/raw", dynamicMiddleware.ThenFunc(app.rawSnippet))
+	mux.Get("/s/:slug/download", dynamicMiddleware.ThenFunc(app.downloadSnippet))
+	mux.Post("/s/:slug/reveal", dynamicMiddleware.ThenFunc(app.revealSnippet))
+	mux.Post("/s/:slug/unlock", dynamicMiddleware.ThenFunc(app.unlockSnippet))
+	mux.Get("/snippet/:id/delete", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.deleteSnippetForm))
+	mux.Post("/snippet/:id/delete", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.deleteSnippet))
 
 	// Add the five new routes for user authentication.
 	mux.Get("/user/signup", dynamicMiddleware.ThenFunc(app.signupUserForm))
@@ -39,9 +73,29 @@ func (app *application) routes() http.Handler {
 	mux.Post("/user/login", dynamicMiddleware.ThenFunc(app.loginUser))
 	// Require auth middleware for auth'd/logged-in actions
 	mux.Post("/user/logout", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.logoutUser))
+	mux.Get("/user/tokens", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.listTokens))
+	mux.Post("/user/tokens", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.createToken))
+	mux.Post("/user/tokens/:id/revoke", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.revokeToken))
+	mux.Get("/user/webhooks", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.listWebhooks))
+	mux.Post("/user/webhooks", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.createWebhook))
+	mux.Get("/user/webhooks/:id", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.showWebhook))
+	mux.Post("/user/webhooks/:id/delete", dynamicMiddleware.Append(app.requireAuth).ThenFunc(app.deleteWebhook))
+
+	// The JSON API has its own middleware chain. API clients aren't browsers, so there's no
+	// session or CSRF token; requests are authenticated with a personal API token instead.
+	// Tokens are created with the user's email address and password, which no other route
+	// accepts.
+	apiMiddleware := alice.New(app.authenticateToken)
+
+	mux.Get("/api/v1/snippets", apiMiddleware.ThenFunc(app.apiListSnippets))
+	mux.Post("/api/v1/snippets", apiMiddleware.Append(app.requireAPIAuth).ThenFunc(app.apiCreateSnippet))
+	mux.Get("/api/v1/snippets/:id", apiMiddleware.ThenFunc(app.apiShowSnippet))
+	mux.Put("/api/v1/snippets/:id", apiMiddleware.Append(app.requireAPIAuth).ThenFunc(app.apiUpdateSnippet))
+	mux.Del("/api/v1/snippets/:id", apiMiddleware.Append(app.requireAPIAuth).ThenFunc(app.apiDeleteSnippet))
+	mux.Post("/api/v1/tokens", alice.New(app.requireBasicAuth).ThenFunc(app.apiCreateToken))
 
 	fileServer := http.FileServer(http.Dir("./ui/static"))
 	mux.Get("/static/", http.StripPrefix("/static", fileServer))
 
-	return standardMiddleware.Then(mux)
+	return mux
 }
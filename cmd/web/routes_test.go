@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/pat"
+)
+
+// openAPIDocument holds the parts of the OpenAPI document which describe the routes.
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Parameters map[string]openAPIParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Parameters []openAPIParameter         `json:"parameters"`
+	Responses  map[string]json.RawMessage `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+// route is a route registered with the router, with its pattern in OpenAPI form (like
+// "/snippet/{id}") and the names of its URL parameters.
+type route struct {
+	method string
+	path   string
+	params []string
+}
+
+// registeredRoutes returns the routes registered with a pat router. Pat doesn't export its
+// routing table, so it's read with reflection. The HEAD routes which pat adds for every GET
+// route, and the redirects it adds for patterns with a trailing slash, are left out.
+func registeredRoutes(t *testing.T, mux *pat.PatternServeMux) []route {
+	handlers := reflect.ValueOf(mux).Elem().FieldByName("handlers")
+	if !handlers.IsValid() || handlers.Kind() != reflect.Map {
+		t.Fatal("can't find the routing table of the pat router")
+	}
+
+	var routes []route
+	for _, method := range handlers.MapKeys() {
+		if method.String() == "HEAD" {
+			continue
+		}
+
+		list := handlers.MapIndex(method)
+		for i := 0; i < list.Len(); i++ {
+			h := list.Index(i).Elem()
+			if h.FieldByName("redirect").Bool() {
+				continue
+			}
+
+			rt := route{method: strings.ToLower(method.String())}
+			segments := strings.Split(h.FieldByName("pat").String(), "/")
+			for j, segment := range segments {
+				if strings.HasPrefix(segment, ":") {
+					rt.params = append(rt.params, segment[1:])
+					segments[j] = "{" + segment[1:] + "}"
+				}
+			}
+			rt.path = strings.Join(segments, "/")
+			routes = append(routes, rt)
+		}
+	}
+
+	return routes
+}
+
+// TestOpenAPIDocument tests that the OpenAPI document served at /openapi.json describes
+// exactly the routes registered by the router, with the same URL parameters.
+func TestOpenAPIDocument(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+
+	b, err := os.ReadFile("./../../ui/static/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("want OpenAPI version 3; got %q", doc.OpenAPI)
+	}
+
+	described := make(map[string]bool)
+	for _, rt := range registeredRoutes(t, app.router()) {
+		// Patterns ending in a slash match whole subtrees (like the static files under
+		// /static/), which OpenAPI paths can't describe.
+		if rt.path != "/" && strings.HasSuffix(rt.path, "/") {
+			continue
+		}
+
+		name := strings.ToUpper(rt.method) + " " + rt.path
+		described[name] = true
+
+		op, ok := doc.Paths[rt.path][rt.method]
+		if !ok {
+			t.Errorf("route %s is missing from the OpenAPI document", name)
+			continue
+		}
+
+		if len(op.Responses) == 0 {
+			t.Errorf("route %s has no responses in the OpenAPI document", name)
+		}
+
+		var params []string
+		for _, p := range op.Parameters {
+			if p.Ref != "" {
+				p = doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+			}
+			if p.In == "path" {
+				params = append(params, p.Name)
+			}
+		}
+		sort.Strings(params)
+		sort.Strings(rt.params)
+		if strings.Join(params, ",") != strings.Join(rt.params, ",") {
+			t.Errorf("route %s: want path parameters %q; document has %q", name, rt.params,
+				params)
+		}
+	}
+
+	// Every operation in the document must also be a registered route, so that removed or
+	// renamed routes don't linger in the document.
+	for path, item := range doc.Paths {
+		for method := range item {
+			name := strings.ToUpper(method) + " " + path
+			if !described[name] {
+				t.Errorf("%s is in the OpenAPI document, but isn't a registered route", name)
+			}
+		}
+	}
+}
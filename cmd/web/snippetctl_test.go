@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DataDavD/snippetbox/pkg/cli"
+	"github.com/DataDavD/snippetbox/pkg/client"
+	"github.com/DataDavD/snippetbox/pkg/models"
+	"github.com/DataDavD/snippetbox/pkg/models/mock"
+)
+
+// recordingSnippets records the snippets created through the application, and their tags,
+// so that tests can check what a client sent.
+type recordingSnippets struct {
+	*mock.SnippetModel
+
+	mu       sync.Mutex
+	inserted *models.Snippet
+	tags     []string
+}
+
+func (m *recordingSnippets) Insert(s *models.Snippet) (int, string, error) {
+	m.mu.Lock()
+	m.inserted = s
+	m.mu.Unlock()
+	return m.SnippetModel.Insert(s)
+}
+
+func (m *recordingSnippets) SetTags(id int, tags []string) error {
+	m.mu.Lock()
+	m.tags = tags
+	m.mu.Unlock()
+	return m.SnippetModel.SetTags(id, tags)
+}
+
+// snippetctl runs snippetctl with the given arguments and standard input, using the config
+// file at configPath, and returns what it printed to standard output and standard error.
+func snippetctl(configPath, stdin string, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	c := &cli.Command{Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr}
+	err := c.Run(append([]string{"-config", configPath}, args...))
+	return stdout.String(), stderr.String(), err
+}
+
+// TestSnippetctl tests the snippetctl commands against the application, wired up with the
+// mock models. The test server's certificate is self-signed, so snippetctl logs in with
+// -insecure, like it does against the development server.
+func TestSnippetctl(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	snippets := &recordingSnippets{SnippetModel: &mock.SnippetModel{}}
+	app.snippets = snippets
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	config := filepath.Join(t.TempDir(), ".snippetctl.json")
+
+	t.Run("Login", func(t *testing.T) {
+		stdout, stderr, err := snippetctl(config, "validPa$$word\n", "login", "-server",
+			ts.URL, "-email", "alice@example.com", "-insecure", "-expires", "30")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(stdout, "Logged in to "+ts.URL) {
+			t.Errorf("want a logged in message; got %q", stdout)
+		}
+		if stderr != "Password: " {
+			t.Errorf("want a password prompt; got %q", stderr)
+		}
+
+		// The token is saved in the config file, which only the user can read.
+		fi, err := os.Stat(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("want mode %v; got %v", os.FileMode(0600), fi.Mode().Perm())
+		}
+	})
+
+	t.Run("Login with prompts", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".snippetctl.json")
+		stdout, stderr, err := snippetctl(path, "alice@example.com\nvalidPa$$word\n", "-json",
+			"login", "-server", ts.URL, "-insecure")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stderr != "Email: Password: " {
+			t.Errorf("want email and password prompts; got %q", stderr)
+		}
+
+		var tok client.Token
+		if err := json.Unmarshal([]byte(stdout), &tok); err != nil {
+			t.Fatal(err)
+		}
+		if tok.Token != mock.MockToken || tok.Expires != nil {
+			t.Errorf("want token %q which never expires; got %+v", mock.MockToken, tok)
+		}
+	})
+
+	t.Run("Login with wrong password", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".snippetctl.json")
+		_, _, err := snippetctl(path, "wrong\n", "login", "-server", ts.URL, "-email",
+			"bob@example.com", "-insecure")
+		wantStatus(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		stdout, _, err := snippetctl(config, "package main\n", "create", "-t", "Title", "-e",
+			"7", "-visibility", "unlisted", "-language", "go", "-tags", "go,cli",
+			"-max-views", "3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ts.URL + "/s/anOldSilentPond0000001\n"; stdout != want {
+			t.Errorf("want %q; got %q", want, stdout)
+		}
+
+		snippets.mu.Lock()
+		defer snippets.mu.Unlock()
+		s := snippets.inserted
+		if s.Title != "Title" || s.Content != "package main\n" || s.UserID != 1 ||
+			s.Visibility != models.VisibilityUnlisted || s.Language != "go" ||
+			s.ViewsLeft == nil || *s.ViewsLeft != 3 {
+			t.Errorf("want the flags and content sent; got %+v", s)
+		}
+		if strings.Join(snippets.tags, ",") != "go,cli" {
+			t.Errorf("want tags %q; got %q", "go,cli", snippets.tags)
+		}
+	})
+
+	t.Run("Create never expiring", func(t *testing.T) {
+		if _, _, err := snippetctl(config, "Content", "create", "-title", "Title",
+			"-never"); err != nil {
+			t.Fatal(err)
+		}
+
+		snippets.mu.Lock()
+		defer snippets.mu.Unlock()
+		if snippets.inserted.Expires != nil {
+			t.Errorf("want a never expiring snippet; got %v", snippets.inserted.Expires)
+		}
+	})
+
+	t.Run("Create invalid", func(t *testing.T) {
+		_, _, err := snippetctl(config, "Content", "create", "-e", "1000")
+		wantStatus(t, err, http.StatusUnprocessableEntity)
+		for _, want := range []string{"title: This field cannot be blank", "expires:"} {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("want the error to contain %q; got %v", want, err)
+			}
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		stdout, _, err := snippetctl(config, "", "get", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stdout != "An old silent pond..." {
+			t.Errorf("want the content; got %q", stdout)
+		}
+	})
+
+	t.Run("Get other user's private snippet", func(t *testing.T) {
+		_, _, err := snippetctl(config, "", "get", "4")
+		wantStatus(t, err, http.StatusNotFound)
+	})
+
+	// The -json flag can be given before or after the command name.
+	for _, args := range [][]string{{"-json", "get", "6"}, {"get", "-json", "6"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			stdout, _, err := snippetctl(config, "", args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var s models.Snippet
+			if err := json.Unmarshal([]byte(stdout), &s); err != nil {
+				t.Fatal(err)
+			}
+			if s.ID != 6 || s.Title != "Alice's private snippet" {
+				t.Errorf("want Alice's private snippet; got %+v", s)
+			}
+		})
+	}
+
+	t.Run("List", func(t *testing.T) {
+		stdout, _, err := snippetctl(config, "", "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") ||
+			!strings.Contains(lines[1], "An old silent pond") ||
+			!strings.Contains(lines[1], "Alice") {
+			t.Errorf("want a header and one snippet; got %q", stdout)
+		}
+	})
+
+	t.Run("List JSON", func(t *testing.T) {
+		stdout, _, err := snippetctl(config, "", "list", "-json", "-page", "1", "-per-page",
+			"5")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var list client.SnippetList
+		if err := json.Unmarshal([]byte(stdout), &list); err != nil {
+			t.Fatal(err)
+		}
+		if list.Page != 1 || list.PerPage != 5 || len(list.Snippets) != 1 {
+			t.Errorf("want page 1 of 5 with one snippet; got %+v", list)
+		}
+	})
+}
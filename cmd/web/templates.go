@@ -1,22 +1,64 @@
 package main
 
 import (
+	"bytes"
 	"html/template"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"github.com/DataDavD/snippetbox/pkg/diff"
 	"github.com/DataDavD/snippetbox/pkg/forms"
 	"github.com/DataDavD/snippetbox/pkg/models"
 )
 
+// pagination holds the details needed to render the position in, and links between, the
+// pages of a listing.
+type pagination struct {
+	Page       int
+	PerPage    int
+	Total      int
+	TotalPages int
+	PrevURL    string
+	NextURL    string
+}
+
 type templateData struct {
-	CSRFToken       string
-	CurrentYear     int
-	Flash           string
-	Form            *forms.Form
-	IsAuthenticated bool
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
+	AuthenticatedUserID int
+	CSRFToken           string
+	CurrentYear         int
+	Deliveries          []*models.Delivery
+	Diff                []diff.Hunk
+	DiffFrom            *models.Revision
+	DiffTo              *models.Revision
+	Flash               string
+	Form                *forms.Form
+	IsAuthenticated     bool
+	NewToken            string
+	Pagination          *pagination
+	Query               string
+	Revisions           []*models.Revision
+	Snippet             *models.Snippet
+	Snippets            []*models.Snippet
+	Tag                 string
+	Tags                []string
+	Tokens              []*models.Token
+	Webhook             *models.Webhook
+	Webhooks            []*models.Webhook
 }
 
 // humanDate returns a nicely formatted human-readable string representation of time.Time.
@@ -30,11 +72,256 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// add returns the sum of a and b. Templates have no arithmetic of their own, so this is
+// handy for things like looking at the next item while ranging over a slice.
+func add(a, b int) int {
+	return a + b
+}
+
+// contains reports whether list contains s. It's used to check the checkboxes of
+// multi-valued form fields.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// searchTermsRX matches the words of a search query, ignoring the operators used by MySQL
+// full-text searches.
+var searchTermsRX = regexp.MustCompile(`[^\s+\-<>()~*"@]+`)
+
+// searchRX returns a case-insensitive regular expression matching any of the words in the
+// search query, or nil if the query contains no words. Longer words are tried first, so
+// that a word is highlighted in full rather than just a shorter word it contains.
+func searchRX(query string) *regexp.Regexp {
+	terms := searchTermsRX.FindAllString(query, -1)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// highlight returns text as HTML, with each occurrence of the words in the search query
+// wrapped in <mark> tags. The text itself is escaped, so the result is safe to render.
+func highlight(text, query string) template.HTML {
+	rx := searchRX(query)
+	if rx == nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
+// excerpt returns up to n characters of text, starting a little before the first
+// occurrence of any of the words in the search query. Ellipses mark where text was cut.
+func excerpt(text, query string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+
+	start := 0
+	if rx := searchRX(query); rx != nil {
+		if loc := rx.FindStringIndex(text); loc != nil {
+			start = utf8.RuneCountInString(text[:loc[0]]) - n/4
+		}
+	}
+	if start > len(runes)-n {
+		start = len(runes) - n
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	out := string(runes[start : start+n])
+	if start > 0 {
+		out = "…" + out
+	}
+	if start+n < len(runes) {
+		out += "…"
+	}
+	return out
+}
+
+// language is a language which snippets can be syntax highlighted as. Value is stored
+// against the snippet, and is the name of the chroma lexer used to highlight it. Ext is the
+// file extension used when the snippet is downloaded.
+type language struct {
+	Value string
+	Name  string
+	Ext   string
+}
+
+// languages lists the languages offered by the snippet form, in the order they're shown.
+var languages = []language{
+	{"text", "Plain text", ".txt"},
+	{"bash", "Bash", ".sh"},
+	{"css", "CSS", ".css"},
+	{"docker", "Dockerfile", ".dockerfile"},
+	{"go", "Go", ".go"},
+	{"html", "HTML", ".html"},
+	{"java", "Java", ".java"},
+	{"javascript", "JavaScript", ".js"},
+	{"json", "JSON", ".json"},
+	{"python", "Python", ".py"},
+	{"ruby", "Ruby", ".rb"},
+	{"rust", "Rust", ".rs"},
+	{"sql", "SQL", ".sql"},
+	{"typescript", "TypeScript", ".ts"},
+	{"yaml", "YAML", ".yaml"},
+}
+
+// languageValues returns the values of all the languages, for validating the snippet form.
+func languageValues() []string {
+	values := make([]string, len(languages))
+	for i, l := range languages {
+		values[i] = l.Value
+	}
+	return values
+}
+
+// codeFormatter renders highlighted code as HTML, using CSS classes rather than inline
+// styles. The classes are styled in ui/static/css/main.css.
+var codeFormatter = html.New(html.WithClasses(true))
+
+// highlightCode returns code as HTML, syntax highlighted as the given language. Chroma
+// escapes the code as it goes, so the result is safe to render. If the language isn't known
+// or highlighting fails, the code is returned escaped but without highlighting.
+func highlightCode(code, language string) template.HTML {
+	plain := template.HTML(`<pre class="chroma"><code>` + template.HTMLEscapeString(code) +
+		`</code></pre>`)
+
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return plain
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return plain
+	}
+
+	var b strings.Builder
+	if err = codeFormatter.Format(&b, styles.Fallback, iterator); err != nil {
+		return plain
+	}
+
+	return template.HTML(b.String())
+}
+
+// highlightCSS returns the stylesheet for the classes used by highlightCode. Pages include
+// main.css instead, but embedded snippets are self-contained, so they inline it.
+func highlightCSS() template.CSS {
+	var b strings.Builder
+	if err := codeFormatter.WriteCSS(&b, styles.Fallback); err != nil {
+		return ""
+	}
+	return template.CSS(b.String())
+}
+
+// safeLinks is a goldmark AST transformer which disarms links and images whose URLs could
+// run script when clicked, such as "javascript:" URLs. Goldmark's own check is
+// case-sensitive and isn't applied to autolinks, so we only allow a short list of schemes.
+type safeLinks struct{}
+
+// safeSchemes are the URL schemes allowed in Markdown links. URLs without a scheme are
+// relative, so they're allowed too.
+var safeSchemes = map[string]bool{"": true, "http": true, "https": true, "mailto": true}
+
+// safeURL reports whether dest is a relative URL or uses one of the safeSchemes. Character
+// references in dest are only resolved when it's rendered, so we resolve them before
+// checking it.
+func safeURL(dest []byte) bool {
+	dest = util.ResolveEntityNames(util.ResolveNumericReferences(dest))
+	u, err := url.Parse(string(bytes.TrimSpace(dest)))
+	return err == nil && safeSchemes[strings.ToLower(u.Scheme)]
+}
+
+// Transform implements parser.ASTTransformer. Unsafe links and images lose their URL, and
+// unsafe autolinks are replaced with their text.
+func (safeLinks) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var autoLinks []*ast.AutoLink
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			if !safeURL(n.Destination) {
+				n.Destination = nil
+			}
+		case *ast.Image:
+			if !safeURL(n.Destination) {
+				n.Destination = nil
+			}
+		case *ast.AutoLink:
+			if n.AutoLinkType == ast.AutoLinkURL && !safeURL(n.URL(source)) {
+				autoLinks = append(autoLinks, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Nodes can't be replaced while walking the tree, so it's done afterwards.
+	for _, n := range autoLinks {
+		n.Parent().ReplaceChild(n.Parent(), n, ast.NewString(n.Label(source)))
+	}
+}
+
+// markdownRenderer converts CommonMark to HTML. Raw HTML in the Markdown is left out,
+// because goldmark omits it unless the html.WithUnsafe option is used.
+var markdownRenderer = goldmark.New(
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(safeLinks{}, 1000)),
+	),
+)
+
+// markdown returns the Markdown text rendered as HTML. Raw HTML and links which could run
+// script are left out, so the result is safe to render.
+func markdown(text string) template.HTML {
+	var b bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(text), &b); err != nil {
+		return template.HTML(`<pre>` + template.HTMLEscapeString(text) + `</pre>`)
+	}
+	return template.HTML(b.String())
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This is essentially
 // a string-keyed map which acts as a lookup between the names of our custom template
 // functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"add":           add,
+	"contains":      contains,
+	"events":        func() []string { return models.Events },
+	"excerpt":       excerpt,
+	"highlight":     highlight,
+	"highlightCSS":  highlightCSS,
+	"highlightCode": highlightCode,
+	"humanDate":     humanDate,
+	"languages":     func() []language { return languages },
+	"markdown":      markdown,
 }
 
 func newTemplateCache(dir string) (map[string]*template.Template, error) {
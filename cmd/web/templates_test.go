@@ -1,8 +1,12 @@
 package main
 
 import (
+	"html/template"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/alecthomas/chroma/lexers"
 )
 
 // TestHumanDate tests that the humanDate function correctly returns a UTC date in our
@@ -56,3 +60,156 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+// TestHighlight tests that the words of a search query are wrapped in <mark> tags, ignoring
+// case and full-text search operators, and that the rest of the text is escaped.
+func TestHighlight(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  template.HTML
+	}{
+		{"No query", "An old <pond>", "", "An old &lt;pond&gt;"},
+		{"Single word", "An old silent pond", "pond", "An old silent <mark>pond</mark>"},
+		{"Case insensitive", "An old silent Pond", "pond", "An old silent <mark>Pond</mark>"},
+		{"Several words", "An old silent pond", "old pond", "An <mark>old</mark> silent <mark>pond</mark>"},
+		{"Operators", "An old silent pond", "+silent -frog*", "An old <mark>silent</mark> pond"},
+		{"Escaped match", "a <b> c", "<b>", "a &lt;<mark>b</mark>&gt; c"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := highlight(tt.text, tt.query)
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestExcerpt tests that excerpts are cut from around the first match of the search query.
+func TestExcerpt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		n     int
+		want  string
+	}{
+		{"Short text", "An old silent pond", "pond", 100, "An old silent pond"},
+		{"Match at start", "An old silent pond", "an", 6, "An old…"},
+		{"Match in middle", "An old silent pond, a frog jumps", "silent", 8, "…d silent…"},
+		{"Match at end", "An old silent pond", "pond", 8, "…ent pond"},
+		{"No match", "An old silent pond", "frog", 6, "An old…"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := excerpt(tt.text, tt.query, tt.n)
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestHighlightCode tests that code is syntax highlighted with CSS classes, and that it's
+// always escaped.
+func TestHighlightCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		code     string
+		language string
+		want     []string
+		wantNot  []string
+	}{
+		{"Go", "package main", "go", []string{`<span class="kn">package</span>`}, nil},
+		{"SQL", "SELECT 1", "sql", []string{`<span class="k">SELECT</span>`}, nil},
+		{"Plain text", "package main", "text", []string{"package main"},
+			[]string{`class="kn"`}},
+		{"Unknown language", "a <b> c", "cobol-ish", []string{"a &lt;b&gt; c"}, nil},
+		{"Escaped", `x := "<script>"`, "go", []string{"&lt;script&gt;"}, []string{"<script>"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := string(highlightCode(tt.code, tt.language))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("want %q to contain %q", got, want)
+				}
+			}
+			for _, wantNot := range tt.wantNot {
+				if strings.Contains(got, wantNot) {
+					t.Errorf("want %q not to contain %q", got, wantNot)
+				}
+			}
+		})
+	}
+}
+
+// TestLanguages tests that every language offered by the snippet form can be highlighted.
+func TestLanguages(t *testing.T) {
+	for _, l := range languages {
+		if lexers.Get(l.Value) == nil {
+			t.Errorf("no lexer for language %q", l.Value)
+		}
+	}
+}
+
+// TestMarkdown tests that Markdown is rendered as HTML, without raw HTML or links which
+// could run script.
+func TestMarkdown(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantNot string
+	}{
+		{"Heading", "# Notes", "<h1>Notes</h1>", ""},
+		{"List", "- one\n- two", "<li>one</li>\n<li>two</li>", ""},
+		{"Fenced code", "```go\nx := 1 < 2\n```", `<pre><code class="language-go">x := 1 &lt; 2`, ""},
+		{"Link", "[docs](https://example.com/)", `<a href="https://example.com/">docs</a>`, ""},
+		{"Relative link", "[home](/)", `<a href="/">home</a>`, ""},
+		{"Raw HTML", "<script>alert(1)</script>", "raw HTML omitted", "<script>"},
+		{"Inline raw HTML", "a <img src=x onerror=alert(1)> b", "a <!-- raw HTML omitted --> b",
+			"onerror"},
+		{"JavaScript link", "[x](javascript:alert(1))", `<a href="">x</a>`, "alert"},
+		{"Upper case JavaScript link", "[x](JAVASCRIPT:alert(1))", `<a href="">x</a>`, "alert"},
+		{"Entity JavaScript link", "[x](&#106;avascript:alert(1))", `<a href="">x</a>`, "alert"},
+		{"Named entity JavaScript link", "[x](javascript&colon;alert(1))", `<a href="">x</a>`,
+			"alert"},
+		{"JavaScript image", "![x](javascript:alert(1))", `<img src="" alt="x">`, "alert"},
+		{"JavaScript autolink", "<javascript:alert(1)>", "<p>javascript:alert(1)</p>", "href"},
+		{"Autolink", "<https://example.com/>", `<a href="https://example.com/">`, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := string(markdown(tt.text))
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("want %q to contain %q", got, tt.want)
+			}
+			if tt.wantNot != "" && strings.Contains(got, tt.wantNot) {
+				t.Errorf("want %q not to contain %q", got, tt.wantNot)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"html"
 	"io"
 	"log"
@@ -9,9 +10,11 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/DataDavD/snippetbox/pkg/models"
 	"github.com/DataDavD/snippetbox/pkg/models/mock"
 	"github.com/golangcollege/sessions"
 )
@@ -48,15 +51,44 @@ func newTestApp(t *testing.T) *application {
 
 	// Initialize the dependencies, using the mocks for the loggers and database models.
 	return &application{
-		errorLog:      log.New(io.Discard, "", 0),
-		infoLog:       log.New(io.Discard, "", 0),
-		session:       session,
-		snippets:      &mock.SnippetModel{},
-		templateCache: templateCache,
-		users:         &mock.UserModel{},
+		baseURL:        "https://snippetbox.example.com",
+		checkpoints:    &mock.CheckpointModel{},
+		errorLog:       log.New(io.Discard, "", 0),
+		events:         &recordingNotifier{},
+		infoLog:        log.New(io.Discard, "", 0),
+		loginAttempts:  newAttemptLimiter(15 * time.Minute),
+		session:        session,
+		snippets:       &mock.SnippetModel{},
+		templateCache:  templateCache,
+		tokens:         &mock.TokenModel{},
+		unlockAttempts: newAttemptLimiter(15 * time.Minute),
+		users:          &mock.UserModel{},
+		webhooks:       &mock.WebhookModel{},
 	}
 }
 
+// recordingNotifier records the webhook events sent by the application, in place of the
+// webhook dispatcher. The dispatcher itself is tested in the webhook package.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (n *recordingNotifier) Notify(event string, s *models.Snippet) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, fmt.Sprintf("%s %d", event, s.ID))
+}
+
+// take returns the events recorded so far, and forgets them.
+func (n *recordingNotifier) take() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	events := n.events
+	n.events = nil
+	return events
+}
+
 // Define a custom testServer type which anonymously embeds a httptest.Server instance.
 type testServer struct {
 	*httptest.Server
@@ -133,3 +165,51 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers, and body.
 	return rs.StatusCode, rs.Header, body
 }
+
+// login signs the test server's client in as the mock user "alice@example.com". The
+// resulting session cookie is kept in the client's cookie jar, so subsequent requests
+// made with the client are authenticated.
+func (ts *testServer) login(t *testing.T) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login: want %d; got %d", http.StatusSeeOther, code)
+	}
+}
+
+// do sends an arbitrary request to the test server. The request's URL is relative to the
+// test server, and setup (if not nil) is called to add headers before the request is sent.
+func (ts *testServer) do(t *testing.T, method, urlPath string, body io.Reader,
+	setup func(*http.Request)) (int, http.Header, []byte) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(req)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := rs.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	rb, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, rb
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter throttles guessing, like trying password after password on a protected
+// snippet. Each attempt counts against one or more keys (such as a snippet, and a snippet and
+// client network), and each key is allowed a number of attempts in any period of length
+// window. Attempts are counted before they're checked and only forgotten if they succeed,
+// so guesses sent in parallel can't get past the limit while the first ones are still being
+// checked. It's safe for concurrent use, and only lives in memory, so it's reset whenever
+// the application restarts.
+type attemptLimiter struct {
+	window time.Duration
+	clock  clock
+
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newAttemptLimiter(window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		window:   window,
+		clock:    realClock{},
+		attempts: make(map[string][]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// attempt records an attempt at time now against every key in limits, which maps each key
+// to the most attempts it's allowed. If any of the keys has used up its attempts, nothing is
+// recorded and attempt returns false.
+func (l *attemptLimiter) attempt(now time.Time, limits map[string]int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, max := range limits {
+		if len(l.recent(key, now)) >= max {
+			return false
+		}
+	}
+	for key := range limits {
+		l.attempts[key] = append(l.attempts[key], now)
+	}
+	return true
+}
+
+// succeed forgets the attempt recorded at time now against every key in limits, once it has
+// succeeded, so that only failed attempts count.
+func (l *attemptLimiter) succeed(now time.Time, limits map[string]int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key := range limits {
+		attempts := l.attempts[key]
+		for i := len(attempts) - 1; i >= 0; i-- {
+			if attempts[i].Equal(now) {
+				attempts = append(attempts[:i:i], attempts[i+1:]...)
+				break
+			}
+		}
+		if len(attempts) == 0 {
+			delete(l.attempts, key)
+		} else {
+			l.attempts[key] = attempts
+		}
+	}
+}
+
+// Start sweeps the limiter in the background once every window, until Stop is called.
+func (l *attemptLimiter) Start() {
+	go l.run()
+}
+
+// Stop stops sweeping the limiter.
+func (l *attemptLimiter) Stop() {
+	close(l.stop)
+	<-l.done
+}
+
+func (l *attemptLimiter) run() {
+	defer close(l.done)
+	for {
+		select {
+		case <-l.clock.After(l.window):
+			l.sweep(l.clock.Now())
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// sweep forgets every key whose attempts are all too old to count at time now, so that the
+// map doesn't keep growing with clients which have stopped trying.
+func (l *attemptLimiter) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key := range l.attempts {
+		l.recent(key, now)
+	}
+}
+
+// recent drops the attempts against key which are outside the window ending at now, and
+// returns the rest. The caller must hold l.mu.
+func (l *attemptLimiter) recent(key string, now time.Time) []time.Time {
+	attempts := l.attempts[key]
+	for len(attempts) > 0 && !attempts[0].After(now.Add(-l.window)) {
+		attempts = attempts[1:]
+	}
+	if len(attempts) == 0 {
+		delete(l.attempts, key)
+	} else {
+		l.attempts[key] = attempts
+	}
+	return attempts
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	t.Parallel()
+	l := newAttemptLimiter(time.Minute)
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	a := map[string]int{"a": 3, "all": 4}
+	b := map[string]int{"b": 3, "all": 4}
+
+	// Three attempts in a minute use up the attempts for key "a", but not for others.
+	for i := 0; i < 3; i++ {
+		if !l.attempt(start.Add(time.Duration(i)*10*time.Second), a) {
+			t.Fatalf("attempt %d: want allowed; got refused", i+1)
+		}
+	}
+	if l.attempt(start.Add(30*time.Second), a) {
+		t.Error("want the 4th attempt refused; got allowed")
+	}
+
+	// The shared key allows one more attempt from "b", and then refuses both.
+	if !l.attempt(start.Add(30*time.Second), b) {
+		t.Error("want another key allowed; got refused")
+	}
+	if l.attempt(start.Add(30*time.Second), b) {
+		t.Error("want the shared key's 5th attempt refused; got allowed")
+	}
+	if got := len(l.attempts["b"]); got != 1 {
+		t.Errorf("want refused attempts not recorded; got %d attempts", got)
+	}
+
+	// A success forgets its attempt, against every key.
+	l.succeed(start.Add(30*time.Second), b)
+	if _, ok := l.attempts["b"]; ok || len(l.attempts["all"]) != 3 {
+		t.Errorf("want the successful attempt forgotten; got %v", l.attempts)
+	}
+
+	// Once the first attempt is a minute old, one more attempt is allowed.
+	if !l.attempt(start.Add(time.Minute), a) {
+		t.Error("want an attempt allowed after the window; got refused")
+	}
+	if l.attempt(start.Add(time.Minute), a) {
+		t.Error("want the next attempt refused; got allowed")
+	}
+}
+
+// TestAttemptLimiterConcurrent tests that attempts made at the same time can't get past the
+// limit.
+func TestAttemptLimiterConcurrent(t *testing.T) {
+	t.Parallel()
+	l := newAttemptLimiter(time.Minute)
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.attempt(now, map[string]int{"a": 5}) {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Errorf("want 5 attempts allowed; got %d", allowed)
+	}
+}
+
+// TestAttemptLimiterSweep tests that the limiter forgets keys whose attempts are all too old
+// to count, once every window.
+func TestAttemptLimiterSweep(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	clock := newFakeClock(start)
+	l := newAttemptLimiter(time.Minute)
+	l.clock = clock
+	l.attempt(start, map[string]int{"a": 5})
+	l.attempt(start.Add(30*time.Second), map[string]int{"b": 5})
+	l.Start()
+	defer l.Stop()
+
+	clock.wait(t)
+	clock.Advance(time.Minute)
+	clock.wait(t)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.attempts["a"]; ok || len(l.attempts) != 1 {
+		t.Errorf("want only key %q kept; got %v", "b", l.attempts)
+	}
+}
+
+func TestClientNetwork(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"[2001:db8:1:2:3:4:5:6]:1234", "2001:db8:1:2::/64"},
+		{"[2001:db8:1:2:ffff::1]:1234", "2001:db8:1:2::/64"},
+		{"[::ffff:192.0.2.1]:1234", "::ffff:192.0.2.1"},
+		{"pipe", "pipe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr}
+			if got := clientNetwork(r); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ module github.com/DataDavD/snippetbox
 go 1.15
 
 require (
+	github.com/alecthomas/chroma v0.10.0
 	github.com/bmizerany/pat v0.0.0-20210406213842-e4b6760bdd6f
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/golangcollege/sessions v1.2.0
 	github.com/justinas/alice v1.2.0
 	github.com/justinas/nosurf v1.1.1
+	github.com/yuin/goldmark v1.4.0
 	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6
 	golang.org/x/sys v0.0.0-20210525143221-35b2ab0089ea // indirect
 )
@@ -0,0 +1,373 @@
+// Package cli implements the snippetctl command, which works with a Snippetbox server from
+// the terminal. It's kept apart from the command itself so that it can be tested against
+// the application's routes.
+package cli
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DataDavD/snippetbox/pkg/client"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const usage = `usage: snippetctl [-config FILE] [-json] COMMAND [ARGS]
+
+Commands:
+  login    log in to a server, and save an API token in the config file
+  create   create a snippet from standard input
+  get      print a snippet
+  list     list the latest public snippets
+
+Run "snippetctl COMMAND -h" for the options of each command.
+`
+
+// config is the configuration saved in the dotfile by "snippetctl login".
+type config struct {
+	Server   string `json:"server"`
+	Token    string `json:"token"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// Command runs snippetctl. It holds the global options and the configuration shared by every
+// subcommand, which read and write through Stdin, Stdout and Stderr, so that they can be
+// tested.
+type Command struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	configPath string
+	json       bool
+	cfg        *config
+}
+
+// ErrUsage is returned when a command is used wrongly, after its usage has been printed.
+var ErrUsage = errors.New("usage")
+
+// Run parses the global flags, loads the configuration, and runs the command. Asking for
+// help returns flag.ErrHelp, and using a command wrongly returns ErrUsage, once the help or
+// usage has been printed.
+func (c *Command) Run(args []string) error {
+	fs := flag.NewFlagSet("snippetctl", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	fs.StringVar(&c.configPath, "config", defaultConfigPath(), "config file")
+	fs.BoolVar(&c.json, "json", false, "print JSON output")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	var err error
+	if c.cfg, err = loadConfig(c.configPath); err != nil {
+		return err
+	}
+
+	commands := map[string]func([]string) error{
+		"login":  c.login,
+		"create": c.create,
+		"get":    c.get,
+		"list":   c.list,
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+	return cmd(fs.Args()[1:])
+}
+
+// flags returns a flag set for a command. Every command accepts the -json flag, so that it
+// can be given either before or after the command name.
+func (c *Command) flags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: snippetctl %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&c.json, "json", c.json, "print JSON output")
+	return fs
+}
+
+// parse parses the flags of a flag set, which prints the error and usage if they're wrong.
+// Asking for help returns flag.ErrHelp, and any other error returns ErrUsage.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return ErrUsage
+	}
+	return nil
+}
+
+// client returns an API client for the configured server.
+func (c *Command) client() (*client.Client, error) {
+	if c.cfg.Server == "" || c.cfg.Token == "" {
+		return nil, errors.New(`not logged in; run "snippetctl login" first`)
+	}
+	return c.newClient(c.cfg.Server, c.cfg.Token, c.cfg.Insecure), nil
+}
+
+// newClient returns an API client for the server. The development server uses a
+// self-signed TLS certificate, so certificate verification can be turned off.
+func (c *Command) newClient(server, token string, insecure bool) *client.Client {
+	cl := client.New(server, token)
+	if insecure {
+		cl.HTTPClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return cl
+}
+
+// login asks for the user's email address and password, creates an API token with them,
+// and saves it in the config file. The password is never saved.
+func (c *Command) login(args []string) error {
+	fs := c.flags("login", "[-server URL] [-email EMAIL] [-insecure]")
+	server := fs.String("server", or(c.cfg.Server, "https://localhost:4000"), "server URL")
+	email := fs.String("email", "", "email address")
+	insecure := fs.Bool("insecure", c.cfg.Insecure, "don't verify the server's TLS certificate")
+	days := fs.Int("expires", 0, "days until the token expires (30, 90 or 365; 0 for never)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(c.Stdin)
+	var err error
+	if *email == "" {
+		if *email, err = c.prompt(in, "Email: "); err != nil {
+			return err
+		}
+	}
+	password, err := c.readPassword(in)
+	if err != nil {
+		return err
+	}
+
+	// Name the token after the machine, so that it can be recognized on the settings page.
+	host, _ := os.Hostname()
+	name := strings.TrimSpace("snippetctl " + host)
+
+	cl := c.newClient(*server, "", *insecure)
+	t, err := cl.Login(*email, password, name, *days)
+	if err != nil {
+		return err
+	}
+
+	c.cfg = &config{Server: cl.BaseURL, Token: t.Token, Insecure: *insecure}
+	if err := saveConfig(c.configPath, c.cfg); err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(t)
+	}
+	_, err = fmt.Fprintf(c.Stdout, "Logged in to %s. The API token %q is saved in %s.\n",
+		cl.BaseURL, t.Name, c.configPath)
+	return err
+}
+
+// create creates a snippet with the content read from standard input, and prints its URL.
+func (c *Command) create(args []string) error {
+	fs := c.flags("create", "-t TITLE [-e DAYS | -never] [options] < FILE")
+	var in client.SnippetInput
+	fs.StringVar(&in.Title, "t", "", "title (shorthand)")
+	fs.StringVar(&in.Title, "title", "", "title")
+	fs.IntVar(&in.Expires, "e", 365, "days until the snippet expires, up to 999 (shorthand)")
+	fs.IntVar(&in.Expires, "expires", 365, "days until the snippet expires, up to 999")
+	fs.BoolVar(&in.NeverExpires, "never", false, "never expire the snippet")
+	fs.StringVar(&in.Visibility, "visibility", "", "public, unlisted or private")
+	fs.StringVar(&in.Language, "language", "", "language for syntax highlighting")
+	fs.StringVar(&in.Format, "format", "", "plain or markdown")
+	tags := fs.String("tags", "", "comma-separated tags")
+	fs.IntVar(&in.MaxViews, "max-views", 0, "delete the snippet after this many views, up to 100")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *tags != "" {
+		in.Tags = strings.Split(*tags, ",")
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(c.Stdin)
+	if err != nil {
+		return err
+	}
+	in.Content = string(content)
+
+	s, err := cl.Create(&in)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(s)
+	}
+	_, err = fmt.Fprintf(c.Stdout, "%s/s/%s\n", cl.BaseURL, s.Slug)
+	return err
+}
+
+// get prints the content of the snippet with the given ID.
+func (c *Command) get(args []string) error {
+	fs := c.flags("get", "[-json] ID")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return ErrUsage
+	}
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || id < 1 {
+		return fmt.Errorf("invalid snippet ID %q", fs.Arg(0))
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	s, err := cl.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(s)
+	}
+	_, err = io.WriteString(c.Stdout, s.Content)
+	return err
+}
+
+// list prints a page of the latest public snippets, one per line.
+func (c *Command) list(args []string) error {
+	fs := c.flags("list", "[-json] [-page N] [-per-page N]")
+	page := fs.Int("page", 1, "page number")
+	perPage := fs.Int("per-page", 20, "snippets per page")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	list, err := cl.List(*page, *perPage)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(list)
+	}
+
+	tw := tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tAUTHOR\tCREATED")
+	for _, s := range list.Snippets {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.ID, s.Title, or(s.Author, "Anonymous"),
+			s.Created.Local().Format("02 Jan 2006 at 15:04"))
+	}
+	return tw.Flush()
+}
+
+// prompt asks for a line of input.
+func (c *Command) prompt(in *bufio.Reader, label string) (string, error) {
+	fmt.Fprint(c.Stderr, label)
+	line, err := in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readPassword asks for the password. When standard input is a terminal the password isn't
+// echoed; otherwise (when it's piped in by a script) it's read as a line of input.
+func (c *Command) readPassword(in *bufio.Reader) (string, error) {
+	if f, ok := c.Stdin.(*os.File); ok && terminal.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(c.Stderr, "Password: ")
+		b, err := terminal.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(c.Stderr)
+		return string(b), err
+	}
+	return c.prompt(in, "Password: ")
+}
+
+// printJSON prints v as indented JSON.
+func (c *Command) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// defaultConfigPath returns the path of the config file: $SNIPPETCTL_CONFIG if it's set, or
+// .snippetctl.json in the user's home directory.
+func defaultConfigPath() string {
+	if path := os.Getenv("SNIPPETCTL_CONFIG"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".snippetctl.json"
+	}
+	return filepath.Join(home, ".snippetctl.json")
+}
+
+// loadConfig reads the config file. A missing file isn't an error; it just means that the
+// user hasn't logged in yet.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// saveConfig writes the config file. It holds an API token, so only the user may read it.
+func saveConfig(path string, cfg *config) error {
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the permissions of an existing file.
+	return os.Chmod(path, 0600)
+}
+
+// or returns s, or def if s is empty.
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run runs snippetctl with the given arguments and standard input, using the config file at
+// configPath, and returns what it printed to standard output and standard error. Commands
+// which talk to a server are tested against the application's routes, in cmd/web.
+func run(configPath, stdin string, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	c := &Command{Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr}
+	err := c.Run(append([]string{"-config", configPath}, args...))
+	return stdout.String(), stderr.String(), err
+}
+
+// TestConfig tests that the config file is read and written, and that only the user can
+// read it once it's written, since it holds an API token.
+func TestConfig(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	t.Run("Missing", func(t *testing.T) {
+		cfg, err := loadConfig(filepath.Join(dir, "missing.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *cfg != (config{}) {
+			t.Errorf("want an empty config; got %+v", cfg)
+		}
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		path := filepath.Join(dir, "new.json")
+		want := config{Server: "https://example.com", Token: "sbx_token", Insecure: true}
+		if err := saveConfig(path, &want); err != nil {
+			t.Fatal(err)
+		}
+		wantMode(t, path, 0600)
+
+		got, err := loadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("want %+v; got %+v", want, got)
+		}
+	})
+
+	t.Run("Existing file", func(t *testing.T) {
+		path := filepath.Join(dir, "existing.json")
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// The umask might have removed permissions, so set them explicitly.
+		if err := os.Chmod(path, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveConfig(path, &config{Token: "sbx_token"}); err != nil {
+			t.Fatal(err)
+		}
+		wantMode(t, path, 0600)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.json")
+		if err := os.WriteFile(path, []byte("token: abc"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("want an error naming %s; got %v", path, err)
+		}
+	})
+}
+
+// wantMode checks the permissions of the file at path.
+func wantMode(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != want {
+		t.Errorf("want mode %v; got %v", want, got)
+	}
+}
+
+// TestUsage tests the errors for commands and arguments which are wrong before any request
+// is sent.
+func TestUsage(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), ".snippetctl.json")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    error
+		wantMsg    string
+		wantStderr string
+	}{
+		{"No command", nil, ErrUsage, "", "usage: snippetctl [-config FILE]"},
+		{"Unknown command", []string{"delete", "1"}, nil, `unknown command "delete"`, ""},
+		{"Help", []string{"get", "-h"}, flag.ErrHelp, "", "usage: snippetctl get [-json] ID"},
+		{"Invalid flag", []string{"create", "-e", "soon"}, ErrUsage, "",
+			"usage: snippetctl create -t TITLE"},
+		{"No ID", []string{"get"}, ErrUsage, "", "usage: snippetctl get"},
+		{"Two IDs", []string{"get", "1", "3"}, ErrUsage, "", "usage: snippetctl get"},
+		{"Invalid ID", []string{"get", "foo"}, nil, `invalid snippet ID "foo"`, ""},
+		{"Zero ID", []string{"get", "0"}, nil, `invalid snippet ID "0"`, ""},
+		{"Not logged in", []string{"list"}, nil,
+			`not logged in; run "snippetctl login" first`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, err := run(path, "", tt.args...)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("want error %v; got %v", tt.wantErr, err)
+			}
+			if tt.wantMsg != "" && (err == nil || err.Error() != tt.wantMsg) {
+				t.Errorf("want error %q; got %v", tt.wantMsg, err)
+			}
+			if !strings.Contains(stderr, tt.wantStderr) {
+				t.Errorf("want stderr to contain %q; got %q", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package client is a Go client for the Snippetbox JSON API, used by the snippetctl
+// command-line tool.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// Client sends requests to a Snippetbox server. Requests are authenticated with Token, if
+// it's set.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the server at baseURL (like "https://localhost:4000"), which
+// authenticates with the given personal API token.
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Error is an error response from the server. Fields holds the validation errors for each
+// field, when a snippet fails validation.
+type Error struct {
+	StatusCode int
+	Message    string              `json:"error"`
+	Fields     map[string][]string `json:"fields"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("snippetbox: %s", e.Message)
+	}
+
+	// Sort the fields, so that the message is the same every time.
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, strings.Join(e.Fields[name], ", ")))
+	}
+	return fmt.Sprintf("snippetbox: %s (%s)", e.Message, strings.Join(msgs, "; "))
+}
+
+// SnippetInput holds the fields of a new snippet. The snippet expires after Expires days, at
+// ExpiresAt (to the minute), or never if NeverExpires is set; only one of them should be
+// given. The server defaults Visibility, Language and Format to public, plain text snippets
+// if they're left empty. If MaxViews is set, the snippet is deleted after it has been viewed
+// that many times, and if Password is set, the snippet can only be seen with it. Encrypted
+// marks Content as the ciphertext of a snippet encrypted by the client.
+type SnippetInput struct {
+	Title        string     `json:"title"`
+	Content      string     `json:"content"`
+	Expires      int        `json:"expires,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	NeverExpires bool       `json:"never_expires,omitempty"`
+	Visibility   string     `json:"visibility,omitempty"`
+	Language     string     `json:"language,omitempty"`
+	Format       string     `json:"format,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	MaxViews     int        `json:"max_views,omitempty"`
+	Password     string     `json:"password,omitempty"`
+	Encrypted    bool       `json:"encrypted,omitempty"`
+}
+
+// SnippetList is a page of snippets. Next is the URL of the next page, if there is one.
+type SnippetList struct {
+	Snippets []*models.Snippet `json:"snippets"`
+	Page     int               `json:"page"`
+	PerPage  int               `json:"per_page"`
+	Total    int               `json:"total"`
+	Next     string            `json:"next"`
+}
+
+// Token is a newly created personal API token. Expires is nil for tokens which never
+// expire.
+type Token struct {
+	Token   string     `json:"token"`
+	Name    string     `json:"name"`
+	Expires *time.Time `json:"expires"`
+}
+
+// Login creates a personal API token with the user's email address and password, and sets
+// it as the client's token. The token is named after name, and expires after the given
+// number of days (or never, if days is 0).
+func (c *Client) Login(email, password, name string, days int) (*Token, error) {
+	body := map[string]interface{}{"name": name, "expires": days}
+
+	t := &Token{}
+	err := c.do(http.MethodPost, "/api/v1/tokens", body, t, func(r *http.Request) {
+		r.SetBasicAuth(email, password)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.Token = t.Token
+	return t, nil
+}
+
+// Create creates a snippet, and returns it as saved by the server.
+func (c *Client) Create(in *SnippetInput) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	if err := c.do(http.MethodPost, "/api/v1/snippets", in, s, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the snippet with the given ID.
+func (c *Client) Get(id int) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/api/v1/snippets/%d", id), nil, s, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns a page of the latest public snippets, numbered from 1.
+func (c *Client) List(page, perPage int) (*SnippetList, error) {
+	query := url.Values{}
+	query.Set("page", fmt.Sprint(page))
+	query.Set("per_page", fmt.Sprint(perPage))
+
+	list := &SnippetList{}
+	if err := c.do(http.MethodGet, "/api/v1/snippets?"+query.Encode(), nil, list, nil); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// do sends a request to the API, encoding body (if not nil) as the JSON request body and
+// decoding the JSON response into dst. setup (if not nil) is called to add headers before
+// the request is sent. Error responses are returned as an *Error.
+func (c *Client) do(method, path string, body, dst interface{}, setup func(*http.Request)) error {
+	var rb io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rb = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, rb)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if setup != nil {
+		setup(req)
+	}
+
+	rs, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode >= 400 {
+		e := &Error{StatusCode: rs.StatusCode}
+		if err := json.NewDecoder(rs.Body).Decode(e); err != nil || e.Message == "" {
+			e.Message = http.StatusText(rs.StatusCode)
+		}
+		return e
+	}
+
+	return json.NewDecoder(rs.Body).Decode(dst)
+}
@@ -0,0 +1,297 @@
+// Package diff computes line-based differences between two texts and groups them into
+// unified diff hunks.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op describes how a line in a diff relates the old text to the new text. Its value is the
+// prefix used for the line in unified diff output.
+type Op string
+
+const (
+	Equal  Op = " "
+	Insert Op = "+"
+	Delete Op = "-"
+)
+
+// Line is a single line of a diff. OldNum and NewNum are the 1-based line numbers of the
+// line in the old and new texts; they are 0 for lines which only appear in the other text.
+type Line struct {
+	Op     Op
+	Text   string
+	OldNum int
+	NewNum int
+}
+
+// Hunk is a group of changed lines together with the unchanged lines surrounding them.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// Header returns the hunk's range information in the "@@ -1,3 +1,4 @@" unified diff format.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// splitLines splits s into lines, treating "\r\n" and "\n" as line endings. A trailing line
+// ending does not produce an empty final line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// maxEdits bounds the work done to find the shortest edit script between two parts of the
+// texts. Finding it takes time proportional to the number of lines times the number of
+// edits, so without a bound two long, completely different revisions would take minutes to
+// compare. Parts which need more edits than this are shown as entirely deleted and then
+// entirely inserted, which is still a correct diff, just not the shortest one.
+const maxEdits = 1000
+
+// Lines returns the full line-by-line diff between the old and new texts, including
+// unchanged lines. It uses the linear space variant of Myers' algorithm, so the result is a
+// shortest edit script with deletions ordered before insertions, unless the texts differ
+// too much (see maxEdits).
+func Lines(old, new string) []Line {
+	var lines []Line
+	compare(splitLines(old), splitLines(new), &lines)
+
+	// Number the lines.
+	oldNum, newNum := 0, 0
+	for i := range lines {
+		switch lines[i].Op {
+		case Equal:
+			oldNum++
+			newNum++
+			lines[i].OldNum, lines[i].NewNum = oldNum, newNum
+		case Delete:
+			oldNum++
+			lines[i].OldNum = oldNum
+		case Insert:
+			newNum++
+			lines[i].NewNum = newNum
+		}
+	}
+
+	return lines
+}
+
+// compare appends the diff between a and b to lines. Rather than keeping the whole edit
+// graph in memory, it finds a point which a shortest edit script passes through, roughly
+// halfway along, and then diffs the parts before and after that point on their own. This
+// needs memory proportional to the number of lines, rather than the number of lines times
+// the number of edits.
+func compare(a, b []string, lines *[]Line) {
+	// Lines which are the same at the start or end of both texts are always unchanged.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for _, text := range a[:prefix] {
+		*lines = append(*lines, Line{Op: Equal, Text: text})
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if x, y, ok := bisect(a, b); ok {
+		compare(a[:x], b[:y], lines)
+		compare(a[x:], b[y:], lines)
+	} else {
+		for _, text := range a {
+			*lines = append(*lines, Line{Op: Delete, Text: text})
+		}
+		for _, text := range b {
+			*lines = append(*lines, Line{Op: Insert, Text: text})
+		}
+	}
+
+	for _, text := range common {
+		*lines = append(*lines, Line{Op: Equal, Text: text})
+	}
+}
+
+// bisect finds the point (x, y) where the forward and backward searches of Myers' algorithm
+// meet, which splits a shortest edit script between a and b into a[:x] to b[:y] followed by
+// a[x:] to b[y:]. It reports false if a or b is empty, if they have no lines in common, or if
+// they differ by more than maxEdits, in which case every line of a is deleted and every
+// line of b is inserted.
+func bisect(a, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	// vf and vb hold, for each diagonal k, the furthest x reached so far by the forward
+	// search from the start of the texts and the backward search from their ends. The
+	// backward search counts x from the end of a. Diagonals range from -d to d, so we offset
+	// the index into them by maxD.
+	maxD := (n + m + 1) / 2
+	if maxD > maxEdits {
+		maxD = maxEdits
+	}
+	offset := maxD
+	vf := make([]int, 2*maxD+2)
+	vb := make([]int, 2*maxD+2)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	// When the difference in length is odd the searches can only meet while extending the
+	// forward search, and when it's even only while extending the backward one. Diagonals
+	// which run off the edge of the edit graph are skipped by narrowing the range of k.
+	delta := n - m
+	front := delta%2 != 0
+	kfStart, kfEnd, kbStart, kbEnd := 0, 0, 0, 0
+
+	for d := 0; d < maxD; d++ {
+		for k := -d + kfStart; k <= d-kfEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1] // move down: an insertion
+			} else {
+				x = vf[offset+k-1] + 1 // move right: a deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+
+			switch {
+			case x > n:
+				kfEnd += 2
+			case y > m:
+				kfStart += 2
+			case front:
+				kb := offset + delta - k
+				if kb >= 0 && kb < len(vb) && vb[kb] != -1 && x >= n-vb[kb] {
+					return x, y, true
+				}
+			}
+		}
+
+		for k := -d + kbStart; k <= d-kbEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+
+			switch {
+			case x > n:
+				kbEnd += 2
+			case y > m:
+				kbStart += 2
+			case !front:
+				kf := offset + delta - k
+				if kf >= 0 && kf < len(vf) && vf[kf] != -1 {
+					fx := vf[kf]
+					fy := fx - (kf - offset)
+					if fx >= n-x {
+						return fx, fy, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// Unified returns the differences between the old and new texts as unified diff hunks,
+// with up to context unchanged lines shown around each change. Changes which are close
+// enough for their context to overlap are merged into a single hunk. If the texts are
+// identical, Unified returns nil.
+func Unified(old, new string, context int) []Hunk {
+	lines := Lines(old, new)
+
+	var hunks []Hunk
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// Found a change: extend the hunk backwards by the context, and forwards until we
+		// reach a run of more than 2*context unchanged lines (or the end of the diff).
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].Op != Equal {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		hunks = append(hunks, newHunk(lines, start, stop))
+		i = stop
+	}
+
+	return hunks
+}
+
+// newHunk builds a hunk from lines[start:stop], working out its ranges in the old and new
+// texts.
+func newHunk(lines []Line, start, stop int) Hunk {
+	h := Hunk{Lines: lines[start:stop]}
+
+	// Count the lines of each text which come before the hunk.
+	for _, l := range lines[:start] {
+		if l.Op != Insert {
+			h.OldStart++
+		}
+		if l.Op != Delete {
+			h.NewStart++
+		}
+	}
+
+	for _, l := range h.Lines {
+		if l.Op != Insert {
+			h.OldLines++
+		}
+		if l.Op != Delete {
+			h.NewLines++
+		}
+	}
+
+	// Ranges start at the hunk's first line, except that by convention an empty range
+	// starts at the line before it.
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+
+	return h
+}
@@ -0,0 +1,207 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want []Line
+	}{
+		{
+			name: "Identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: []Line{{Equal, "a", 1, 1}, {Equal, "b", 2, 2}},
+		},
+		{
+			name: "Empty old",
+			old:  "",
+			new:  "a\nb",
+			want: []Line{{Insert, "a", 0, 1}, {Insert, "b", 0, 2}},
+		},
+		{
+			name: "Empty new",
+			old:  "a",
+			new:  "",
+			want: []Line{{Delete, "a", 1, 0}},
+		},
+		{
+			name: "Changed line",
+			old:  "a\nb\nc",
+			new:  "a\nB\nc",
+			want: []Line{{Equal, "a", 1, 1}, {Delete, "b", 2, 0}, {Insert, "B", 0, 2},
+				{Equal, "c", 3, 3}},
+		},
+		{
+			name: "CRLF line endings",
+			old:  "a\r\nb\r\n",
+			new:  "a\nb\n",
+			want: []Line{{Equal, "a", 1, 1}, {Equal, "b", 2, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := Lines(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestLinesShortest checks the diffs of random texts against the longest common subsequence
+// of their lines: a diff must turn the old text into the new one, and a shortest diff keeps
+// every line of the longest common subsequence.
+func TestLinesShortest(t *testing.T) {
+	t.Parallel()
+	rnd := rand.New(rand.NewSource(1))
+
+	randomText := func() []string {
+		text := make([]string, rnd.Intn(12))
+		for i := range text {
+			text[i] = string(rune('a' + rnd.Intn(3)))
+		}
+		return text
+	}
+
+	for i := 0; i < 1000; i++ {
+		a, b := randomText(), randomText()
+		old, new := strings.Join(a, "\n"), strings.Join(b, "\n")
+
+		var gotOld, gotNew []string
+		equal := 0
+		for _, l := range Lines(old, new) {
+			if l.Op != Insert {
+				gotOld = append(gotOld, l.Text)
+			}
+			if l.Op != Delete {
+				gotNew = append(gotNew, l.Text)
+			}
+			if l.Op == Equal {
+				equal++
+			}
+		}
+		if strings.Join(gotOld, "\n") != old || strings.Join(gotNew, "\n") != new {
+			t.Fatalf("diff of %q and %q doesn't reproduce them", old, new)
+		}
+		if want := lcs(a, b); equal != want {
+			t.Fatalf("diff of %q and %q keeps %d lines; want %d", old, new, equal, want)
+		}
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// TestLinesLarge checks that diffing two long, completely different texts is cheap, since
+// anyone can ask for the diff between two revisions of a public snippet.
+// It doesn't run in parallel, so that other tests don't count towards its allocations.
+func TestLinesLarge(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 4000; i++ {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	old, new := strings.Join(a, "\n"), strings.Join(b, "\n")
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	lines := Lines(old, new)
+	runtime.ReadMemStats(&after)
+
+	if len(lines) != 8000 || lines[0].Op != Delete || lines[7999].Op != Insert {
+		t.Errorf("want 4000 deletions then 4000 insertions; got %d lines", len(lines))
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 10<<20 {
+		t.Errorf("want under 10MB allocated; got %dMB", alloc>>20)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	t.Parallel()
+
+	old := strings.Join([]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, "\n")
+
+	tests := []struct {
+		name        string
+		new         string
+		context     int
+		wantHeaders []string
+	}{
+		{
+			name:        "No changes",
+			new:         old,
+			context:     3,
+			wantHeaders: nil,
+		},
+		{
+			name:        "Single change",
+			new:         strings.Replace(old, "5", "five", 1),
+			context:     1,
+			wantHeaders: []string{"@@ -4,3 +4,3 @@"},
+		},
+		{
+			name:        "Separate hunks",
+			new:         strings.Replace(strings.Replace(old, "2", "two", 1), "9", "nine", 1),
+			context:     1,
+			wantHeaders: []string{"@@ -1,3 +1,3 @@", "@@ -8,3 +8,3 @@"},
+		},
+		{
+			name:        "Merged hunks",
+			new:         strings.Replace(strings.Replace(old, "2", "two", 1), "9", "nine", 1),
+			context:     3,
+			wantHeaders: []string{"@@ -1,10 +1,10 @@"},
+		},
+		{
+			name:        "Pure insertion",
+			new:         strings.Replace(old, "5\n", "5\n5.5\n", 1),
+			context:     0,
+			wantHeaders: []string{"@@ -5,0 +6,1 @@"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			for _, h := range Unified(old, tt.new, tt.context) {
+				got = append(got, h.Header())
+			}
+			if !reflect.DeepEqual(got, tt.wantHeaders) {
+				t.Errorf("want %v; got %v", tt.wantHeaders, got)
+			}
+		})
+	}
+}
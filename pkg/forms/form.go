@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -17,6 +19,14 @@ import (
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](" +
 	"?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// TagRX matches a valid tag: between 1 and 32 letters, digits, dots, dashes or underscores,
+// starting with a letter or digit.
+var TagRX = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,31}$`)
+
+// Base64RX matches a string in standard base64 encoding, with padding, like the content of
+// encrypted snippets.
+var Base64RX = regexp.MustCompile(`^(?:[A-Za-z0-9+/]{4})*(?:[A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)?$`)
+
 // Form anonymously embeds a url.Values object
 // to (to hold the form data) and an FormErrors field to hold any validation errors
 // for the form data
@@ -99,6 +109,117 @@ func (f *Form) MatchesPattern(field string, pattern *regexp.Regexp) {
 	}
 }
 
+// SplitList splits a comma-separated form value into its items, trimming surrounding
+// whitespace and dropping empty or duplicate items.
+func SplitList(value string) []string {
+	var items []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		items = append(items, item)
+	}
+	return items
+}
+
+// MaxItems checks that a comma-separated list field in the form contains at most n items.
+// If the check fails it adds the appropriate message to the form errors.
+func (f *Form) MaxItems(field string, n int) {
+	if len(SplitList(f.Get(field))) > n {
+		f.FormErrors.Add(field, fmt.Sprintf("This field has too many items (maximum is %d)", n))
+	}
+}
+
+// ItemsMatchPattern checks that every item of a comma-separated list field in the form
+// matches a regular expression. If the check fails it adds the appropriate message to the
+// form errors.
+func (f *Form) ItemsMatchPattern(field string, pattern *regexp.Regexp) {
+	for _, item := range SplitList(f.Get(field)) {
+		if !pattern.MatchString(item) {
+			f.FormErrors.Add(field, fmt.Sprintf("%q is invalid", item))
+			return
+		}
+	}
+}
+
+// PermittedItems checks that every value of a multi-valued field in the form (like a group
+// of checkboxes) is one of a set of permitted values. If the check fails it adds the
+// appropriate message to the form errors.
+func (f *Form) PermittedItems(field string, opts ...string) {
+	for _, value := range f.Values[field] {
+		permitted := false
+		for _, opt := range opts {
+			if value == opt {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			f.FormErrors.Add(field, fmt.Sprintf("%q is invalid", value))
+			return
+		}
+	}
+}
+
+// WebURL checks that a specific field in the form is an absolute http or https URL. If the
+// check fails it adds the appropriate message to the form errors.
+func (f *Form) WebURL(field string) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		f.FormErrors.Add(field, "This field must be an http or https URL")
+	}
+}
+
+// IntRange checks that a specific field in the form is a whole number between min and max
+// (inclusive). If the check fails it adds the appropriate message to the form errors.
+func (f *Form) IntRange(field string, min, max int) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		f.FormErrors.Add(field, "This field must be a whole number")
+		return
+	}
+	if n < min || n > max {
+		f.FormErrors.Add(field, fmt.Sprintf("This field must be between %d and %d", min, max))
+	}
+}
+
+// Date checks that a specific field in the form is a date (and time) in the given layout,
+// between min and max. Dates without a time zone are taken to be in UTC. If the check fails
+// it adds the appropriate message to the form errors.
+func (f *Form) Date(field, layout string, min, max time.Time) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	t, err := time.Parse(layout, strings.TrimSpace(value))
+	if err != nil {
+		f.FormErrors.Add(field, "This field must be a valid date")
+		return
+	}
+	if t.Before(min) {
+		f.FormErrors.Add(field, fmt.Sprintf("This field must be after %s",
+			min.UTC().Format(dateFormat)))
+	} else if t.After(max) {
+		f.FormErrors.Add(field, fmt.Sprintf("This field must be before %s",
+			max.UTC().Format(dateFormat)))
+	}
+}
+
+// dateFormat is the format of the dates in the messages added by Date, which matches the way
+// the application shows dates.
+const dateFormat = "02 Jan 2006 at 15:04"
+
 // Valid method checks FormErrors for any present errors. It returns true if there are no errors,
 // else it returns false if there are errors.
 func (f *Form) Valid() bool {
@@ -0,0 +1,17 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+type CheckpointModel struct{}
+
+func (m *CheckpointModel) Get(name string) (time.Time, error) {
+	return time.Time{}, models.ErrNoRecord
+}
+
+func (m *CheckpointModel) Set(name string, t time.Time) error {
+	return nil
+}
@@ -1,29 +1,249 @@
 package mock
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/DataDavD/snippetbox/pkg/models"
 )
 
+// mockExpires is the expiry time of the mock snippets, apart from snippet 3, which never
+// expires.
+var mockExpires = time.Now().AddDate(1, 0, 0)
+
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	UserID:     1,
+	Author:     "Alice",
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    &mockExpires,
+	Visibility: models.VisibilityPublic,
+	Slug:       "anOldSilentPond0000001",
+	Language:   "text",
+	Format:     models.FormatPlain,
+	Tags:       []string{"poetry"},
+}
+
+// mockSnippets holds every mock snippet by ID. Snippets 1, 6, 7 and 9 were created by
+// mock.MockUser, and the rest by a different user. Snippets 8 and 9 are burn-after-reading
+// snippets, snippet 10 is protected by MockSnippetPassword, and snippet 11 is encrypted.
+var mockSnippets = map[int]*models.Snippet{
+	1: mockSnippet,
+	3: {
+		ID:         3,
+		UserID:     2,
+		Author:     "Bob",
+		Title:      "Over the wintry forest",
+		Content:    "Over the wintry forest...",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    nil,
+		Visibility: models.VisibilityPublic,
+		Slug:       "overTheWintryForest003",
+		Language:   "text",
+		Format:     models.FormatPlain,
+	},
+	4: {
+		ID:         4,
+		UserID:     2,
+		Author:     "Bob",
+		Title:      "Bob's private snippet",
+		Content:    "Bob's private snippet...",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityPrivate,
+		Slug:       "bobsPrivateSnippet0004",
+		Language:   "text",
+		Format:     models.FormatPlain,
+	},
+	5: {
+		ID:         5,
+		UserID:     2,
+		Author:     "Bob",
+		Title:      "Bob's unlisted snippet",
+		Content:    "Bob's unlisted snippet...",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityUnlisted,
+		Slug:       "bobsUnlistedSnippetSlg",
+		Language:   "text",
+		Format:     models.FormatPlain,
+	},
+	6: {
+		ID:         6,
+		UserID:     1,
+		Author:     "Alice",
+		Title:      "Alice's private snippet",
+		Content:    "Alice's private snippet...",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityPrivate,
+		Slug:       "alicesPrivateSnippet06",
+		Language:   "text",
+		Format:     models.FormatPlain,
+	},
+	7: {
+		ID:         7,
+		UserID:     1,
+		Author:     "Alice",
+		Title:      "Onboarding notes",
+		Content:    "# Onboarding\n\n- Get a laptop\n\n<script>alert(1)</script>",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityPublic,
+		Slug:       "onboardingNotes0000007",
+		Language:   "text",
+		Format:     models.FormatMarkdown,
+	},
+	8: {
+		ID:         8,
+		UserID:     2,
+		Author:     "Bob",
+		Title:      "Bob's secret snippet",
+		Content:    "Bob's secret snippet...",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityPublic,
+		Slug:       "bobsSecretSnippet00008",
+		Language:   "text",
+		Format:     models.FormatPlain,
+		ViewsLeft:  intPtr(1),
+	},
+	9: {
+		ID:         9,
+		UserID:     1,
+		Author:     "Alice",
+		Title:      "Alice's secret snippet",
+		Content:    "Alice's secret snippet...",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityUnlisted,
+		Slug:       "alicesSecretSnippet009",
+		Language:   "text",
+		Format:     models.FormatPlain,
+		ViewsLeft:  intPtr(3),
+	},
+	10: {
+		ID:         10,
+		UserID:     2,
+		Author:     "Bob",
+		Title:      "Bob's protected snippet",
+		Content:    "Bob's protected snippet...",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityPublic,
+		Slug:       "bobsProtectedSnippet10",
+		Language:   "text",
+		Format:     models.FormatPlain,
+		Protected:  true,
+	},
+	11: {
+		ID:         11,
+		UserID:     2,
+		Author:     "Bob",
+		Title:      "Bob's encrypted snippet",
+		Content:    "q83vEjRWeJCrze8SNFZ4kKvN7xI0VniQ",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		Expires:    &mockExpires,
+		Visibility: models.VisibilityPublic,
+		Slug:       "bobsEncryptedSnippet11",
+		Language:   "text",
+		Format:     models.FormatPlain,
+		Encrypted:  true,
+	},
+}
+
+// MockSnippetPassword is the password of the protected mock snippet.
+const MockSnippetPassword = "correct horse"
+
+func intPtr(n int) *int {
+	return &n
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
-	return 2, nil
+// Insert pretends to insert a snippet, returning the ID and slug of mockSnippet so that the
+// new snippet can be fetched back.
+func (m *SnippetModel) Insert(s *models.Snippet) (int, string, error) {
+	return mockSnippet.ID, mockSnippet.Slug, nil
 }
 
 func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+	if s, ok := mockSnippets[id]; ok {
+		return s, nil
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	for _, s := range mockSnippets {
+		if s.Slug == slug {
+			return s, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+// View returns a copy of the snippet with the given id with one fewer view left, leaving
+// the mock snippets themselves unchanged.
+func (m *SnippetModel) View(id int) (*models.Snippet, error) {
+	s, ok := mockSnippets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	viewed := *s
+	if s.ViewsLeft != nil {
+		viewed.ViewsLeft = intPtr(*s.ViewsLeft - 1)
+	}
+	return &viewed, nil
+}
+
+func (m *SnippetModel) CheckPassword(id int, password string) error {
+	s, ok := mockSnippets[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+	if !s.Protected || password != MockSnippetPassword {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (m *SnippetModel) Update(s *models.Snippet) error {
+	if s.ID == mockSnippet.ID && s.UserID == mockSnippet.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) Delete(id, userID int) error {
+	if id == mockSnippet.ID && userID == mockSnippet.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) Revisions(id int) ([]*models.Revision, error) {
 	switch id {
 	case 1:
-		return mockSnippet, nil
+		return []*models.Revision{
+			{ID: 2, SnippetID: 1, UserID: 1, Author: "Alice", Title: mockSnippet.Title,
+				Content: mockSnippet.Content, Created: time.Now()},
+			{ID: 1, SnippetID: 1, UserID: 1, Author: "Alice", Title: mockSnippet.Title,
+				Content: "An old pond...", Created: time.Now().Add(-time.Hour)},
+		}, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
@@ -32,3 +252,55 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) ByUser(userID, limit int) ([]*models.Snippet, error) {
+	var snippets []*models.Snippet
+	for _, s := range mockSnippets {
+		if s.UserID == userID && s.Visibility == models.VisibilityPublic && s.ViewsLeft == nil &&
+			!s.Protected && !s.Encrypted {
+			snippets = append(snippets, s)
+		}
+	}
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].ID > snippets[j].ID })
+	if len(snippets) > limit {
+		snippets = snippets[:limit]
+	}
+	return snippets, nil
+}
+
+func (m *SnippetModel) Page(cursor *models.Cursor, offset, limit int) ([]*models.Snippet, int,
+	error) {
+	if cursor != nil || offset > 0 {
+		return nil, 1, nil
+	}
+	return []*models.Snippet{mockSnippet}, 1, nil
+}
+
+func (m *SnippetModel) Search(query string, limit, offset int) ([]*models.Snippet, error) {
+	if offset == 0 && strings.Contains(strings.ToLower(mockSnippet.Content), strings.ToLower(query)) {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return nil, nil
+}
+
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	return nil
+}
+
+func (m *SnippetModel) Tagged(tag string, limit int) ([]*models.Snippet, error) {
+	if tag == "poetry" {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return nil, nil
+}
+
+func (m *SnippetModel) Tags() ([]string, error) {
+	return []string{"poetry"}, nil
+}
+
+func (m *SnippetModel) Expired(from, to time.Time) ([]*models.Snippet, error) {
+	if mockExpires.After(from) && !mockExpires.After(to) {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,44 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// MockToken is a valid API token belonging to MockUser.
+const MockToken = "sbx_mockTokenForAliceMockTokenForAliceMockT"
+
+var mockToken = &models.Token{
+	ID:      1,
+	UserID:  1,
+	Name:    "laptop",
+	Created: time.Now(),
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(userID int, name string, expires time.Time) (string, error) {
+	return MockToken, nil
+}
+
+func (m *TokenModel) List(userID int) ([]*models.Token, error) {
+	if userID == mockToken.UserID {
+		return []*models.Token{mockToken}, nil
+	}
+	return []*models.Token{}, nil
+}
+
+func (m *TokenModel) Revoke(id, userID int) error {
+	if id == mockToken.ID && userID == mockToken.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *TokenModel) Authenticate(token string) (int, error) {
+	if token == MockToken {
+		return mockToken.UserID, nil
+	}
+	return 0, models.ErrInvalidCredentials
+}
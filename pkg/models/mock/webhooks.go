@@ -0,0 +1,57 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+var mockWebhook = &models.Webhook{
+	ID:      1,
+	UserID:  1,
+	URL:     "https://chat.example.com/hooks/snippetbox",
+	Secret:  "mockWebhookSecret",
+	Events:  []string{models.EventSnippetCreated, models.EventSnippetDeleted},
+	Created: time.Now(),
+}
+
+var mockDeliveries = []*models.Delivery{
+	{ID: 2, WebhookID: 1, Event: models.EventSnippetCreated, Payload: `{"event":"snippet.created"}`,
+		Attempt: 2, StatusCode: 200, Created: time.Now()},
+	{ID: 1, WebhookID: 1, Event: models.EventSnippetCreated, Payload: `{"event":"snippet.created"}`,
+		Attempt: 1, StatusCode: 503, Error: "Service Unavailable", Created: time.Now()},
+}
+
+type WebhookModel struct{}
+
+func (m *WebhookModel) Insert(w *models.Webhook) (int, error) {
+	return 2, nil
+}
+
+func (m *WebhookModel) Get(id, userID int) (*models.Webhook, error) {
+	if id == mockWebhook.ID && userID == mockWebhook.UserID {
+		return mockWebhook, nil
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *WebhookModel) List(userID int) ([]*models.Webhook, error) {
+	if userID == mockWebhook.UserID {
+		return []*models.Webhook{mockWebhook}, nil
+	}
+	return []*models.Webhook{}, nil
+}
+
+func (m *WebhookModel) Delete(id, userID int) error {
+	if id == mockWebhook.ID && userID == mockWebhook.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *WebhookModel) Deliveries(webhookID, limit int) ([]*models.Delivery, error) {
+	if webhookID == mockWebhook.ID {
+		return mockDeliveries, nil
+	}
+	return []*models.Delivery{}, nil
+}
@@ -17,12 +17,86 @@ var (
 	ErrDuplicateEmail = errors.New("models: duplicate email")
 )
 
+// Snippet visibility levels. Public snippets are visible to everyone and appear in
+// listings. Unlisted snippets don't appear in listings, and other users can only reach them
+// through their slug URL. Private snippets are only visible to their author.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Snippet formats. Plain text snippets are shown as (syntax highlighted) code, and
+// Markdown snippets are rendered as HTML.
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// Snippet is a snippet of text or code. The JSON encoding of a Snippet is used by the API.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID int `json:"id"`
+	// UserID is the ID of the user who created the snippet and Author is their name.
+	// Snippets created before authors were recorded have a zero UserID and empty Author.
+	UserID  int       `json:"user_id"`
+	Author  string    `json:"author"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	// Updated is when the title or content last changed, which is Created for snippets
+	// which have never been edited.
+	Updated time.Time `json:"updated"`
+	// Expires is nil for snippets which never expire.
+	Expires *time.Time `json:"expires"`
+	// Visibility is one of the Visibility* constants. Slug is a random, unguessable string
+	// used in the snippet's URL in place of its sequential ID.
+	Visibility string `json:"visibility"`
+	Slug       string `json:"slug"`
+	// Language is the name of the language the content is highlighted as, such as "go" or
+	// "sql". Plain text snippets use "text".
+	Language string `json:"language"`
+	// Format is one of the Format* constants.
+	Format string `json:"format"`
+	// Tags is only populated when fetching a single snippet.
+	Tags []string `json:"tags,omitempty"`
+	// ViewsLeft is the number of times a burn-after-reading snippet can still be viewed
+	// before it's deleted, or nil for snippets which can be viewed any number of times.
+	ViewsLeft *int `json:"views_left,omitempty"`
+	// Protected is set for snippets which can only be seen with a password. The password's
+	// hash is never read back; SnippetModel.CheckPassword checks a password against it.
+	Protected bool `json:"protected,omitempty"`
+	// Encrypted is set for snippets which were encrypted in the author's browser. Their
+	// Content is the ciphertext, and the key is never sent to the server.
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Password is the new password for SnippetModel.Insert and Update to set. It's nil to
+	// leave the password as it is, and an empty string to remove it.
+	Password *string `json:"-"`
+}
+
+// Burned reports whether the snippet has used up its last view, and so has been deleted.
+func (s *Snippet) Burned() bool {
+	return s.ViewsLeft != nil && *s.ViewsLeft <= 0
+}
+
+// Cursor marks a position in a listing of snippets ordered newest first, by creation time
+// and then ID. Listings page forwards (to older snippets) from a cursor, or backwards (to
+// newer snippets) if Backward is set.
+type Cursor struct {
+	Created  time.Time
+	ID       int
+	Backward bool
+}
+
+// Revision is a version of a snippet. A revision is recorded each time a snippet is created
+// or edited, so the most recent revision always matches the snippet itself.
+type Revision struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	Author    string
+	Title     string
+	Content   string
+	Created   time.Time
 }
 
 type User struct {
@@ -33,3 +107,57 @@ type User struct {
 	Created  time.Time
 	Active   bool
 }
+
+// Token is a personal API token, which lets non-browser clients authenticate as the user
+// who created it. Only a hash of the token itself is stored, so it isn't part of the struct.
+// LastUsed and Expires are the zero time if the token has never been used, or never expires.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Created  time.Time
+	LastUsed time.Time
+	Expires  time.Time
+}
+
+// Webhook events. Each event is sent when a snippet is created, edited, deleted or expires.
+const (
+	EventSnippetCreated = "snippet.created"
+	EventSnippetUpdated = "snippet.updated"
+	EventSnippetDeleted = "snippet.deleted"
+	EventSnippetExpired = "snippet.expired"
+)
+
+// Events lists every webhook event, in the order they're shown to users.
+var Events = []string{EventSnippetCreated, EventSnippetUpdated, EventSnippetDeleted,
+	EventSnippetExpired}
+
+// Webhook is a user's registration to be notified of events on their snippets. Each event
+// is POSTed as JSON to URL, signed with Secret. Events holds the events the webhook is
+// subscribed to.
+type Webhook struct {
+	ID      int
+	UserID  int
+	URL     string
+	Secret  string
+	Events  []string
+	Created time.Time
+}
+
+// Delivery is an attempt to send an event to a webhook. StatusCode is the status code of
+// the receiver's response, or 0 if there was no response, in which case Error says why.
+type Delivery struct {
+	ID         int
+	WebhookID  int
+	Event      string
+	Payload    string
+	Attempt    int
+	StatusCode int
+	Error      string
+	Created    time.Time
+}
+
+// OK reports whether the delivery succeeded.
+func (d *Delivery) OK() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
@@ -0,0 +1,39 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// CheckpointModel wraps a sql.DB connection pool, and records how far background jobs have
+// got, so that they can carry on where they left off when the application restarts.
+type CheckpointModel struct {
+	DB *sql.DB
+}
+
+// Get returns the time recorded for the checkpoint with the given name. If nothing has been
+// recorded yet, it returns models.ErrNoRecord.
+func (m *CheckpointModel) Get(name string) (time.Time, error) {
+	var t time.Time
+	err := m.DB.QueryRow(`SELECT time FROM checkpoints WHERE name = ?`, name).Scan(&t)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, models.ErrNoRecord
+		}
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+// Set records the time t for the checkpoint with the given name, replacing the time recorded
+// before. Times are stored to the second, so t should be too.
+func (m *CheckpointModel) Set(name string, t time.Time) error {
+	stmt := `INSERT INTO checkpoints (name, time) VALUES(?, ?)
+	ON DUPLICATE KEY UPDATE time = VALUES(time)`
+
+	_, err := m.DB.Exec(stmt, name, t.UTC())
+	return err
+}
@@ -0,0 +1,38 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+func TestCheckpointModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := CheckpointModel{db}
+
+	if _, err := m.Get("expired"); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+
+	// Setting a checkpoint again replaces its time.
+	first := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, want := range []time.Time{first, first.Add(time.Minute)} {
+		if err := m.Set("expired", want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := m.Get("expired")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("want %v; got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+USE snippetbox;
+
+-- Encrypted snippets were encrypted in the author's browser, and their content is the
+-- ciphertext.
+ALTER TABLE snippets
+    ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+USE snippetbox;
+
+-- Whether a snippet's content is shown as code or rendered as Markdown. Existing snippets
+-- are all code.
+ALTER TABLE snippets
+    ADD COLUMN format ENUM ('plain', 'markdown') NOT NULL DEFAULT 'plain';
@@ -0,0 +1,6 @@
+USE snippetbox;
+
+-- The language a snippet's content is syntax highlighted as. Existing snippets are shown as
+-- plain text, like they were before.
+ALTER TABLE snippets
+    ADD COLUMN language VARCHAR(20) NOT NULL DEFAULT 'text';
@@ -0,0 +1,6 @@
+USE snippetbox;
+
+-- Password-protected snippets have a bcrypt hash of their password. Every other snippet has
+-- NULL.
+ALTER TABLE snippets
+    ADD COLUMN password_hash CHAR(60) NULL;
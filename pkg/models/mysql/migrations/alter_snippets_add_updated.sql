@@ -0,0 +1,13 @@
+USE snippetbox;
+
+-- The time a snippet's title or content last changed, for feeds. Existing snippets were last
+-- changed when their latest revision was recorded.
+ALTER TABLE snippets
+    ADD COLUMN updated DATETIME NULL AFTER created;
+
+UPDATE snippets s
+SET updated = COALESCE((SELECT MAX(r.created) FROM snippet_revisions r WHERE r.snippet_id = s.id),
+                       s.created);
+
+ALTER TABLE snippets
+    MODIFY updated DATETIME NOT NULL;
@@ -0,0 +1,10 @@
+USE snippetbox;
+
+-- Record the user who created each snippet. Snippets created before this
+-- migration have no known author, so the column is nullable and they are left
+-- as NULL.
+ALTER TABLE snippets
+    ADD COLUMN user_id INTEGER NULL AFTER id;
+
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
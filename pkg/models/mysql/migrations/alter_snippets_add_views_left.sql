@@ -0,0 +1,6 @@
+USE snippetbox;
+
+-- Burn-after-reading snippets have the number of views they have left, and are deleted when
+-- it reaches zero. Every other snippet has NULL and can be viewed any number of times.
+ALTER TABLE snippets
+    ADD COLUMN views_left INTEGER NULL;
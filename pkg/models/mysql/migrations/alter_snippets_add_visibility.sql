@@ -0,0 +1,10 @@
+USE snippetbox;
+
+-- Existing snippets were visible to everyone, so they default to public. Unlisted snippets
+-- are reached through a random slug instead of their ID.
+ALTER TABLE snippets
+    ADD COLUMN visibility ENUM ('public', 'unlisted', 'private') NOT NULL DEFAULT 'public',
+    ADD COLUMN slug       CHAR(22)                              NULL;
+
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
@@ -0,0 +1,5 @@
+USE snippetbox;
+
+-- Snippets which never expire have a NULL expiry time. Existing snippets keep theirs.
+ALTER TABLE snippets
+    MODIFY COLUMN expires DATETIME NULL;
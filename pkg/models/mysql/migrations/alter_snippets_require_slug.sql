@@ -0,0 +1,11 @@
+USE snippetbox;
+
+-- Every snippet is now reached through its slug rather than its sequential ID, so give the
+-- snippets which don't have one yet a random slug. This is the same encoding as newSlug in
+-- snippets.go: 16 random bytes in URL-safe base64, without the padding.
+UPDATE snippets
+SET slug = TRIM(TRAILING '=' FROM REPLACE(REPLACE(TO_BASE64(RANDOM_BYTES(16)), '+', '-'), '/', '_'))
+WHERE slug IS NULL;
+
+ALTER TABLE snippets
+    MODIFY slug CHAR(22) NOT NULL;
@@ -0,0 +1,20 @@
+USE snippetbox;
+
+-- Personal API tokens. Only the SHA-256 hash of each token is stored, and tokens are looked
+-- up by their hash.
+CREATE TABLE api_tokens
+(
+    id        INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id   INTEGER      NOT NULL,
+    name      VARCHAR(100) NOT NULL,
+    hash      CHAR(64)     NOT NULL,
+    created   DATETIME     NOT NULL,
+    last_used DATETIME     NULL,
+    expires   DATETIME     NULL
+);
+
+ALTER TABLE api_tokens
+    ADD CONSTRAINT api_tokens_uc_hash UNIQUE (hash);
+
+ALTER TABLE api_tokens
+    ADD CONSTRAINT api_tokens_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
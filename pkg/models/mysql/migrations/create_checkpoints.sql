@@ -0,0 +1,9 @@
+USE snippetbox;
+
+-- How far each background job has got, like the time up to which snippet.expired events have
+-- been sent, so that jobs carry on where they left off after a restart.
+CREATE TABLE checkpoints
+(
+    name VARCHAR(64) NOT NULL PRIMARY KEY,
+    time DATETIME    NOT NULL
+);
@@ -0,0 +1,24 @@
+USE snippetbox;
+
+-- Every version of a snippet is kept in snippet_revisions, including the current one. A
+-- new revision is recorded whenever a snippet is created or edited.
+CREATE TABLE snippet_revisions
+(
+    id         INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER      NOT NULL,
+    user_id    INTEGER      NULL,
+    title      VARCHAR(100) NOT NULL,
+    content    TEXT         NOT NULL,
+    created    DATETIME     NOT NULL
+);
+
+ALTER TABLE snippet_revisions
+    ADD CONSTRAINT snippet_revisions_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE;
+
+ALTER TABLE snippet_revisions
+    ADD CONSTRAINT snippet_revisions_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+-- Record the current version of every existing snippet as its first revision.
+INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+SELECT id, user_id, title, content, created
+FROM snippets;
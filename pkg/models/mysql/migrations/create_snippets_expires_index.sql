@@ -0,0 +1,4 @@
+USE snippetbox;
+-- Expired snippets are purged in batches, oldest first.
+CREATE
+    INDEX idx_snippets_expires ON snippets (expires);
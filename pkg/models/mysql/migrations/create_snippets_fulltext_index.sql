@@ -0,0 +1,3 @@
+USE snippetbox;
+CREATE
+    FULLTEXT INDEX idx_snippets_fulltext ON snippets (title, content);
@@ -0,0 +1,34 @@
+USE snippetbox;
+
+-- Webhooks notify a user's own URL of events on their snippets. The secret is used to sign
+-- each payload, so it's stored as it is rather than hashed.
+CREATE TABLE webhooks
+(
+    id      INTEGER       NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER       NOT NULL,
+    url     VARCHAR(2048) NOT NULL,
+    secret  VARCHAR(255)  NOT NULL,
+    events  SET ('snippet.created', 'snippet.updated', 'snippet.deleted', 'snippet.expired') NOT NULL,
+    created DATETIME      NOT NULL
+);
+
+ALTER TABLE webhooks
+    ADD CONSTRAINT webhooks_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+-- Every attempt to deliver an event is logged, so that users can see why deliveries fail.
+CREATE TABLE webhook_deliveries
+(
+    id          INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    webhook_id  INTEGER      NOT NULL,
+    event       VARCHAR(32)  NOT NULL,
+    payload     MEDIUMTEXT   NOT NULL,
+    attempt     INTEGER      NOT NULL,
+    status_code INTEGER      NOT NULL,
+    error       VARCHAR(255) NOT NULL,
+    created     DATETIME     NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+
+ALTER TABLE webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_fk_webhook_id FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE;
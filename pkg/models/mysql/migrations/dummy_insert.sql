@@ -1,25 +1,35 @@
 -- add some dummy records
+-- Run after every other migration. The slugs are fixed, so that the dummy snippets can be
+-- found at /s/<slug>, and the snippets have no author, like those created before users.
 USE snippetbox;
-INSERT INTO snippets (title, content, created, expires)
+INSERT INTO snippets (title, content, created, updated, expires, slug)
 VALUES ('An old silent pond',
         'An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.\n\n– Matsuo Bashō',
         UTC_TIMESTAMP(),
-        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY));
+        UTC_TIMESTAMP(),
+        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY),
+        'anOldSilentPond0000001');
 
-INSERT INTO snippets (title, content, created, expires)
+INSERT INTO snippets (title, content, created, updated, expires, slug)
 VALUES ('Over the wintry forest',
         'Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.\n\n– Natsume Soseki',
         UTC_TIMESTAMP(),
-        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY));
+        UTC_TIMESTAMP(),
+        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY),
+        'overTheWintryForest002');
 
-INSERT INTO snippets (title, content, created, expires)
+INSERT INTO snippets (title, content, created, updated, expires, slug)
 VALUES ('First autumn morning',
         'First autumn morning\nthe mirror I stare into\nshows my father''s face.\n\n– Murakami Kijo',
         UTC_TIMESTAMP(),
-        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY));
+        UTC_TIMESTAMP(),
+        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY),
+        'firstAutumnMorning0003');
 
-INSERT INTO snippets (title, content, created, expires)
+INSERT INTO snippets (title, content, created, updated, expires, slug)
 VALUES ('DataDavD Awesome Adventures in Life',
         'DataDavD has had an awesome, super, crazy, cool life!!!',
         UTC_TIMESTAMP(),
-        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY));
+        UTC_TIMESTAMP(),
+        DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY),
+        'dataDavDAdventures0004');
@@ -1,8 +1,11 @@
 package mysql
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"time"
 
 	// Import the models package that we just created. You need to prefix this with
 	// whatever module path you set up back in chapter 02.02 (Project Setup and Enabling
@@ -10,6 +13,7 @@ import (
 	// "{your-module-path}/pkg/models".
 
 	"github.com/DataDavD/snippetbox/pkg/models"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // SnippetModel is type which wraps a sql.DB connection pool
@@ -17,56 +21,362 @@ type SnippetModel struct {
 	DB *sql.DB
 }
 
-// Insert inserts a new snippet into the database. It returns the ID inserted
-// and error. If there is no error then Insert returns ID and nil. If there is an error,
-// it returns 0 and error.
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
+// selectSnippets is the start of every query which fetches snippets. It joins on the users
+// table to fetch the author's name alongside each snippet. Snippets without an author have
+// NULL columns, so we use a LEFT JOIN and COALESCE the missing values to their zero values.
+// The columns are in the order expected by scanSnippet.
+const selectSnippets = `SELECT s.id, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title,
+	s.content, s.created, s.updated, s.expires, s.visibility, s.slug, s.language,
+	s.format, s.views_left, s.password_hash IS NOT NULL, s.encrypted
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id `
+
+// unexpired is the condition for snippets which haven't expired yet. Snippets which never
+// expire have a NULL expiry time.
+const unexpired = `(s.expires IS NULL OR s.expires > UTC_TIMESTAMP())`
+
+// listed is the condition for snippets which may appear in listings and search results:
+// they must be public and unexpired. Burn-after-reading and password-protected snippets are
+// never listed, since listings, search and feeds would give their content away. Nor are
+// encrypted snippets, which can't be read without the key in the link they were shared with,
+// and whose ciphertext mustn't turn up in search results.
+const listed = `s.visibility = 'public' AND s.views_left IS NULL AND s.password_hash IS NULL
+	AND s.encrypted = FALSE AND ` + unexpired
+
+// querier is implemented by both *sql.DB and *sql.Tx, for queries which are run both on
+// their own and as part of a transaction.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSnippet copies the columns selected by selectSnippets from row into a new Snippet.
+func scanSnippet(row scanner) (*models.Snippet, error) {
+	// Initialize a pointer to a new zeroed Snippet struct.
+	s := &models.Snippet{}
+	var expires sql.NullTime
+	var viewsLeft sql.NullInt64
+
+	// Use row.Scan() to copy the values from each field in the row to the
+	// corresponding field in the Snippet struct. Notice that the arguments
+	// to row.Scan are *pointers* to the place you want to copy the data into,
+	// and the number of arguments must be exactly the same as the number  of
+	// columns returned by your statement
+	err := row.Scan(&s.ID, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Created, &s.Updated,
+		&expires,
+		&s.Visibility, &s.Slug, &s.Language, &s.Format, &viewsLeft,
+		&s.Protected, &s.Encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	// A NULL expiry time means the snippet never expires, which is a nil Expires.
+	if expires.Valid {
+		s.Expires = &expires.Time
+	}
+	// Likewise, a NULL views_left means the snippet can be viewed any number of times.
+	if viewsLeft.Valid {
+		n := int(viewsLeft.Int64)
+		s.ViewsLeft = &n
+	}
+
+	return s, nil
+}
+
+// newSlug returns a random, URL-safe string which is infeasible to guess, for use in the
+// URL of a snippet. 16 random bytes encode to 22 characters, which fits the slug column.
+func newSlug() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Insert inserts a new snippet into the database, recording it as the snippet's first
+// revision. The snippet's author, title, content, expiry time, visibility, language,
+// format, view limit, password and encryption flag are taken from s. Every snippet is given a random slug,
+// which is used in its URL instead of the sequential ID. It returns the ID and slug inserted
+// and error. If there is no error then Insert returns ID, slug and nil. If there
+// is an error, it returns 0, "" and error.
+func (m *SnippetModel) Insert(s *models.Snippet) (int, string, error) {
+	slug, err := newSlug()
+	if err != nil {
+		return 0, "", err
+	}
+
+	hashedPw, err := hashPassword(s.Password)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The snippet and its first revision are written in a single transaction, so that we
+	// never end up with a snippet that has no history.
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+
 	// Write the SQL statement we want to execute. It's split over two lines which
 	// why its surrounded with backquotes instead of normal double quotes.
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (user_id, title, content, created, updated, expires,
+	visibility, slug, language, format, views_left, password_hash, encrypted)
+	VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	// Use the Exec() method on the embedded database connection pool to execute the statement.
+	// Use the Exec() method on the transaction to execute the statement.
 	// The first parameter is the SQL statement, followed by the
-	// title, content and expiry values for the placeholder parameters. This
-	// method returns a sql.Result object, which contains some basic
-	// information about what happened when the statement was executed.
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	// user ID, title, content, expiry, visibility, slug, language, format, view limit,
+	// password hash and encryption flag values for the
+	// placeholder parameters. This method returns a sql.Result object, which contains some
+	// basic information about what happened when the statement was executed.
+	result, err := tx.Exec(stmt, s.UserID, s.Title, s.Content, nullTime(s.Expires),
+		s.Visibility, slug, s.Language, s.Format, nullInt(s.ViewsLeft), hashedPw,
+		s.Encrypted)
 	if err != nil {
-		return 0, err
+		return 0, "", rollback(tx, err)
 	}
 
 	// Use LastInsertID() method on the result object to get the ID of our newly
 	// inserted record in the snippets table.
 	id, err := result.LastInsertId()
 	if err != nil {
-		return 0, err
+		return 0, "", rollback(tx, err)
+	}
+
+	if err = insertRevision(tx, int(id), s.UserID, s.Title, s.Content); err != nil {
+		return 0, "", rollback(tx, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, "", err
 	}
 
 	// The ID returned has the type int64, so we convert it to the int type before returning
-	return int(id), nil
+	return int(id), slug, nil
 }
 
-// Get returns a specific snippet based on the id. It returns ID and error.
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() and id = ?`
+// Update replaces the title, content, expiry time, visibility, language and format of the
+// snippet with the ID s.ID, and its password if s.Password is set. A snippet stays encrypted
+// or unencrypted, whatever s.Encrypted is. Only the user who created the snippet (s.UserID)
+// may update it, so if the snippet doesn't exist, has expired or is owned by another user,
+// nothing is updated and models.ErrNoRecord is returned. If the title or content changed, a
+// new revision is recorded and the snippet's update time is set.
+func (m *SnippetModel) Update(s *models.Snippet) error {
+	hashedPw, err := hashPassword(s.Password)
+	if err != nil {
+		return err
+	}
 
-	// Initialize a pointer to a new zeroed Snippet struct.
-	s := &models.Snippet{}
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Lock the snippet row for the rest of the transaction while we compare the current
+	// version with the new one.
+	var oldTitle, oldContent string
+	stmt := `SELECT title, content FROM snippets s
+	WHERE id = ? AND user_id = ? AND ` + unexpired + ` FOR UPDATE`
+	err = tx.QueryRow(stmt, s.ID, s.UserID).Scan(&oldTitle, &oldContent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = models.ErrNoRecord
+		}
+		return rollback(tx, err)
+	}
+
+	// Only changes to the title or content are worth a new revision, and count as updating
+	// the snippet; extending the expiry on its own doesn't.
+	changed := s.Title != oldTitle || s.Content != oldContent
+
+	stmt = `UPDATE snippets SET title = ?, content = ?, expires = ?, visibility = ?,
+	language = ?, format = ?, updated = IF(?, UTC_TIMESTAMP(), updated) WHERE id = ?`
+	_, err = tx.Exec(stmt, s.Title, s.Content, nullTime(s.Expires), s.Visibility, s.Language,
+		s.Format, changed, s.ID)
+	if err != nil {
+		return rollback(tx, err)
+	}
+
+	if s.Password != nil {
+		_, err = tx.Exec(`UPDATE snippets SET password_hash = ? WHERE id = ?`, hashedPw, s.ID)
+		if err != nil {
+			return rollback(tx, err)
+		}
+	}
+
+	if changed {
+		if err = insertRevision(tx, s.ID, s.UserID, s.Title, s.Content); err != nil {
+			return rollback(tx, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// nullTime converts an optional time into a value for a nullable DATETIME column, in UTC
+// like every other time in the database.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// hashPassword returns a bcrypt hash of a new snippet password, for the nullable
+// password_hash column. There's no hash (NULL) if password is nil or empty.
+func hashPassword(password *string) (sql.NullString, error) {
+	if password == nil || *password == "" {
+		return sql.NullString{}, nil
+	}
+	hashedPw, err := bcrypt.GenerateFromPassword([]byte(*password), 12)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(hashedPw), Valid: true}, nil
+}
+
+// CheckPassword checks the password of the unexpired snippet with the given id. If the
+// snippet doesn't exist it returns models.ErrNoRecord, and if the password is wrong, or the
+// snippet has no password, it returns models.ErrInvalidCredentials.
+func (m *SnippetModel) CheckPassword(id int, password string) error {
+	var hashedPw sql.NullString
+	stmt := `SELECT password_hash FROM snippets s WHERE ` + unexpired + ` AND id = ?`
+	err := m.DB.QueryRow(stmt, id).Scan(&hashedPw)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNoRecord
+		}
+		return err
+	}
+	if !hashedPw.Valid {
+		return models.ErrInvalidCredentials
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPw.String), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return models.ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// nullInt converts an optional int into a value for a nullable INTEGER column.
+func nullInt(n *int) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*n), Valid: true}
+}
+
+// insertRevision records a new revision of the snippet with the given id as part of the
+// transaction tx.
+func insertRevision(tx *sql.Tx, id, userID int, title, content string) error {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := tx.Exec(stmt, id, userID, title, content)
+	return err
+}
+
+// Delete removes the snippet with the given id from the database. Only the user who
+// created the snippet may delete it, so if the snippet doesn't exist or is owned by another
+// user, nothing is deleted and models.ErrNoRecord is returned.
+func (m *SnippetModel) Delete(id, userID int) error {
+	stmt := `DELETE FROM snippets WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	// Use RowsAffected() to check whether a matching snippet was actually deleted.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// View returns the unexpired snippet with the given id, recording that it has been viewed.
+// Burn-after-reading snippets have their ViewsLeft decremented, and once the last view is
+// used up the snippet is deleted, so the snippet returned has ViewsLeft 0. The check and
+// the decrement happen in a single transaction with the snippet's row locked, so that two
+// simultaneous views can't both use the same last view. Snippets without a view limit are
+// returned unchanged.
+func (m *SnippetModel) View(id int) (*models.Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(selectSnippets+`WHERE `+unexpired+` AND s.id = ? FOR UPDATE`, id)
+	s, err := scanSnippet(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = models.ErrNoRecord
+		}
+		return nil, rollback(tx, err)
+	}
+
+	// Fetch the tags before the snippet might be deleted, which deletes them too.
+	if s.Tags, err = snippetTags(tx, id); err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	switch {
+	case s.ViewsLeft == nil:
+		// Nothing to record.
+	case *s.ViewsLeft > 1:
+		_, err = tx.Exec(`UPDATE snippets SET views_left = views_left - 1 WHERE id = ?`, id)
+	default:
+		// This was the last view. Its revisions and tags are deleted along with it by
+		// their foreign keys.
+		_, err = tx.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+	}
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if s.ViewsLeft != nil {
+		*s.ViewsLeft--
+	}
+	return s, nil
+}
 
+// Get returns a specific snippet based on the id. It returns ID and error.
+func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	// Use the QueryRow() method on the connection pool to execute our
 	// SQL statement, passing in the untrusted id variable as the value for the
 	// placeholder parameter. This returns a pointer to a sql.Row object which
 	// holds the result from the database.
-	row := m.DB.QueryRow(stmt, id)
+	row := m.DB.QueryRow(selectSnippets+`WHERE `+unexpired+` AND s.id = ?`, id)
 
-	// Use row.Scan() to copy the values from each field in sql.Row to the
-	// corresponding field in the Snippet struct. Notice that the arguments
-	// to row.Scan are *pointers* to the place you want to copy the data into,
-	// and the number of arguments must be exactly the same as the number  of
-	// columns returned by your statement
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	return m.getSnippet(row)
+}
+
+// GetBySlug returns the unexpired snippet with the given slug.
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	row := m.DB.QueryRow(selectSnippets+`WHERE `+unexpired+` AND s.slug = ?`, slug)
+
+	return m.getSnippet(row)
+}
+
+// getSnippet scans the snippet returned by a single row query, and fetches its tags.
+func (m *SnippetModel) getSnippet(row *sql.Row) (*models.Snippet, error) {
+	s, err := scanSnippet(row)
 	if err != nil {
 		// If the query returns no rows, then row.Scan() will return a
 		// sql.ErrNoRows error. We use the errors.Is() function check for that
@@ -78,25 +388,67 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 		}
 	}
 
+	// Fetch the snippet's tags too.
+	s.Tags, err = snippetTags(m.DB, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// If everything went OK Then return the Snippet object.
 	return s, nil
-
 }
 
-// Latest returns the 10 most recently created snippets.
+// Latest returns the 10 most recently created public snippets.
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP ORDER BY created DESC LIMIT 10`
+	return m.querySnippets(selectSnippets + `WHERE ` + listed + ` ORDER BY s.created DESC LIMIT 10`)
+}
+
+// ByUser returns the most recent listed snippets created by the user with the given userID,
+// newest first.
+func (m *SnippetModel) ByUser(userID, limit int) ([]*models.Snippet, error) {
+	return m.querySnippets(selectSnippets+`WHERE s.user_id = ? AND `+listed+`
+	ORDER BY s.created DESC LIMIT ?`, userID, limit)
+}
+
+// Expired returns the snippets which expired after from and at or before to, oldest first.
+// It's used to send webhook events for snippets as they expire, which would otherwise
+// silently disappear from every query. Snippets which never expire are never included.
+func (m *SnippetModel) Expired(from, to time.Time) ([]*models.Snippet, error) {
+	return m.querySnippets(selectSnippets+`WHERE s.expires > ? AND s.expires <= ?
+	ORDER BY s.expires`, from.UTC(), to.UTC())
+}
 
+// DeleteExpired deletes up to limit snippets which expired at or before the given time,
+// oldest first, along with their revisions and tags. It returns the number of snippets
+// deleted, so that callers can delete every expired snippet in batches by calling it until
+// fewer than limit are deleted, without locking the table for one long delete. Snippets
+// which never expire are never deleted.
+func (m *SnippetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	stmt := `DELETE FROM snippets WHERE expires <= ? ORDER BY expires LIMIT ?`
+
+	result, err := m.DB.Exec(stmt, before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// querySnippets runs a query starting with selectSnippets, and returns the snippets.
+func (m *SnippetModel) querySnippets(stmt string, args ...interface{}) ([]*models.Snippet, error) {
 	// Use the Query() method on the connection pool to execute our SQL statement.
 	// This returns a sql.Rows resultset containing the result of our query.
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	// We defer rows.Close() to ensure the sql.Rows result set is
-	// always properly closed before the Latest() method returns. This defer
+	// always properly closed before the querySnippets() method returns. This defer
 	// statement should come *after* you check for an error from the Query()
 	// method. Otherwise, if Query() returns an error, you'll get a panic
 	// trying to close a nil result set.
@@ -111,12 +463,7 @@ func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	// result set automatically closes itself and frees-up the underlying
 	// database connection.
 	for rows.Next() {
-		// Initialize a pointer to a new zeroed Snippet struct.
-		s := &models.Snippet{}
-
-		// Use row.Scan() to copy the values from each field in sql.Row to the
-		// corresponding field in the Snippet struct.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -134,3 +481,196 @@ func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 
 	return snippets, nil
 }
+
+// Revisions returns every revision of the snippet with the given id, most recent first. If
+// the snippet doesn't exist or has expired, models.ErrNoRecord is returned.
+func (m *SnippetModel) Revisions(id int) ([]*models.Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title,
+	r.content, r.created FROM snippet_revisions r
+	INNER JOIN snippets s ON s.id = r.snippet_id
+	LEFT JOIN users u ON u.id = r.user_id
+	WHERE ` + unexpired + ` AND r.snippet_id = ? ORDER BY r.id DESC`
+
+	rows, err := m.DB.Query(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.Revision
+	for rows.Next() {
+		r := &models.Revision{}
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.UserID, &r.Author, &r.Title, &r.Content,
+			&r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Every snippet has at least one revision, so an empty result means there's no such
+	// (unexpired) snippet.
+	if len(revisions) == 0 {
+		return nil, models.ErrNoRecord
+	}
+
+	return revisions, nil
+}
+
+// Page returns a page of up to limit public snippets, newest first, along with the total
+// number of public snippets. If cursor is nil, the page starts offset snippets into the
+// listing. Otherwise offset is ignored and the page starts immediately after (or before,
+// when paging backwards) the cursor. Paging with a cursor uses the idx_snippets_created
+// index to seek straight to the right position, so it stays fast however deep the page is.
+func (m *SnippetModel) Page(cursor *models.Cursor, offset, limit int) ([]*models.Snippet, int,
+	error) {
+	var total int
+	stmt := `SELECT COUNT(*) FROM snippets s WHERE ` + listed
+	if err := m.DB.QueryRow(stmt).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	stmt = selectSnippets + `WHERE ` + listed + ` `
+
+	var args []interface{}
+	switch {
+	case cursor == nil:
+		stmt += `ORDER BY s.created DESC, s.id DESC LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	case cursor.Backward:
+		// To page backwards we walk the listing in the opposite order, and then reverse
+		// the results below.
+		stmt += `AND (s.created > ? OR (s.created = ? AND s.id > ?))
+		ORDER BY s.created ASC, s.id ASC LIMIT ?`
+		args = append(args, cursor.Created, cursor.Created, cursor.ID, limit)
+	default:
+		stmt += `AND (s.created < ? OR (s.created = ? AND s.id < ?))
+		ORDER BY s.created DESC, s.id DESC LIMIT ?`
+		args = append(args, cursor.Created, cursor.Created, cursor.ID, limit)
+	}
+
+	snippets, err := m.querySnippets(stmt, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if cursor != nil && cursor.Backward {
+		for i, j := 0, len(snippets)-1; i < j; i, j = i+1, j-1 {
+			snippets[i], snippets[j] = snippets[j], snippets[i]
+		}
+	}
+
+	return snippets, total, nil
+}
+
+// Search returns up to limit public snippets whose title or content matches query, most
+// relevant first, skipping the first offset matches. It uses the idx_snippets_fulltext
+// index, so query is interpreted using MySQL's natural language full-text search rules.
+func (m *SnippetModel) Search(query string, limit, offset int) ([]*models.Snippet, error) {
+	stmt := selectSnippets + `WHERE ` + listed + `
+	AND MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE)
+	ORDER BY MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, s.created DESC
+	LIMIT ? OFFSET ?`
+
+	return m.querySnippets(stmt, query, query, limit, offset)
+}
+
+// snippetTags returns the names of the tags on the snippet with the given id, in
+// alphabetical order.
+func snippetTags(q querier, id int) ([]string, error) {
+	stmt := `SELECT t.name FROM tags t INNER JOIN snippet_tags st ON st.tag_id = t.id
+	WHERE st.snippet_id = ? ORDER BY t.name`
+
+	rows, err := q.Query(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// SetTags replaces the tags on the snippet with the given id. Tags which don't exist yet are
+// created.
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, id); err != nil {
+		return rollback(tx, err)
+	}
+
+	for _, tag := range tags {
+		// INSERT IGNORE skips tags which already exist, thanks to the tags_uc_name
+		// constraint.
+		if _, err = tx.Exec(`INSERT IGNORE INTO tags (name) VALUES(?)`, tag); err != nil {
+			return rollback(tx, err)
+		}
+
+		stmt := `INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?`
+		if _, err = tx.Exec(stmt, id, tag); err != nil {
+			return rollback(tx, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Tagged returns up to limit of the most recently created public snippets with the
+// given tag.
+func (m *SnippetModel) Tagged(tag string, limit int) ([]*models.Snippet, error) {
+	stmt := selectSnippets + `INNER JOIN snippet_tags st ON st.snippet_id = s.id
+	INNER JOIN tags t ON t.id = st.tag_id
+	WHERE ` + listed + ` AND t.name = ? ORDER BY s.created DESC LIMIT ?`
+
+	return m.querySnippets(stmt, tag, limit)
+}
+
+// Tags returns the names of all tags in use on public snippets, in alphabetical order.
+func (m *SnippetModel) Tags() ([]string, error) {
+	stmt := `SELECT DISTINCT t.name FROM tags t
+	INNER JOIN snippet_tags st ON st.tag_id = t.id
+	INNER JOIN snippets s ON s.id = st.snippet_id
+	WHERE ` + listed + ` ORDER BY t.name`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,375 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+func TestSnippetModelGet(t *testing.T) {
+	// Skip the test if the '-short' flag is provided when running the test.
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	expires := time.Date(2099, 12, 23, 17, 25, 22, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		snippetID   int
+		wantSnippet *models.Snippet
+		wantError   error
+	}{
+		{
+			name:      "Valid ID",
+			snippetID: 1,
+			wantSnippet: &models.Snippet{
+				ID:         1,
+				UserID:     1,
+				Author:     "Alice Jones2",
+				Title:      "An old silent pond",
+				Content:    "An old silent pond...",
+				Created:    time.Date(2018, 12, 23, 17, 25, 22, 0, time.UTC),
+				Updated:    time.Date(2018, 12, 23, 17, 25, 22, 0, time.UTC),
+				Expires:    &expires,
+				Visibility: models.VisibilityPublic,
+				Slug:       "anOldSilentPond0000001",
+				Language:   "text",
+				Format:     models.FormatPlain,
+			},
+			wantError: nil,
+		},
+		{
+			name:        "Non-existent ID",
+			snippetID:   2,
+			wantSnippet: nil,
+			wantError:   models.ErrNoRecord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, teardown := newTestDB(t)
+			defer teardown()
+
+			m := SnippetModel{db}
+
+			s, err := m.Get(tt.snippetID)
+
+			t.Logf("testing %q for want-snippet %v and want-error %v", tt.name, tt.wantSnippet,
+				tt.wantError)
+
+			if err != tt.wantError {
+				t.Errorf("want %v; got %s", tt.wantError, err)
+			}
+
+			if !reflect.DeepEqual(s, tt.wantSnippet) {
+				t.Errorf("want %v; got %v", tt.wantSnippet, s)
+			}
+		})
+	}
+}
+
+func TestSnippetModelInsert(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := SnippetModel{db}
+
+	id, slug, err := m.Insert(&models.Snippet{
+		UserID:     1,
+		Title:      "Over the wintry forest",
+		Content:    "Over the wintry forest...",
+		Visibility: models.VisibilityPublic,
+		Language:   "text",
+		Format:     models.FormatPlain,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new snippet should be attributed to the user who created it.
+	s, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.UserID != 1 || s.Author != "Alice Jones2" {
+		t.Errorf("want author %d %q; got %d %q", 1, "Alice Jones2", s.UserID, s.Author)
+	}
+
+	// Every snippet is given a random slug, which can be used to fetch it.
+	if len(slug) != 22 || s.Slug != slug {
+		t.Fatalf("want 22 character slug %q; got %q", slug, s.Slug)
+	}
+
+	bySlug, err := m.GetBySlug(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bySlug.ID != id {
+		t.Errorf("want ID %d; got %d", id, bySlug.ID)
+	}
+
+	// The snippet has no expiry time, so it never expires and is listed with the others.
+	if s.Expires != nil {
+		t.Errorf("want no expiry time; got %v", s.Expires)
+	}
+
+	latest, err := m.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 2 || latest[0].ID != id {
+		t.Errorf("want the new snippet first of 2 latest snippets; got %d snippets", len(latest))
+	}
+}
+
+func TestSnippetModelUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := SnippetModel{db}
+
+	s := &models.Snippet{
+		ID:         1,
+		UserID:     2,
+		Title:      "An old silent pond",
+		Content:    "Changed",
+		Visibility: models.VisibilityPublic,
+		Language:   "text",
+		Format:     models.FormatPlain,
+	}
+
+	// Only the author of the snippet can update it.
+	err := m.Update(s)
+	if err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+
+	s.UserID = 1
+	s.Content = "A frog jumps into the pond"
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	s.Expires = &expires
+	err = m.Update(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The edit should be recorded as a new revision, most recent first.
+	revisions, err := m.Revisions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revisions) != 2 {
+		t.Fatalf("want %d revisions; got %d", 2, len(revisions))
+	}
+
+	if revisions[0].Content != "A frog jumps into the pond" {
+		t.Errorf("want latest revision content %q; got %q", "A frog jumps into the pond",
+			revisions[0].Content)
+	}
+
+	updated, err := m.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Expires == nil || !updated.Expires.Equal(expires) {
+		t.Errorf("want expiry time %v; got %v", expires, updated.Expires)
+	}
+	if !updated.Updated.After(updated.Created) {
+		t.Errorf("want an update time after %v; got %v", updated.Created, updated.Updated)
+	}
+}
+
+func TestSnippetModelView(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := SnippetModel{db}
+
+	// Snippets without a view limit are returned unchanged.
+	s, err := m.View(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ViewsLeft != nil {
+		t.Errorf("want no view limit; got %d", *s.ViewsLeft)
+	}
+
+	views := 2
+	id, _, err := m.Insert(&models.Snippet{
+		UserID:     1,
+		Title:      "Database password",
+		Content:    "hunter2",
+		Visibility: models.VisibilityUnlisted,
+		Language:   "text",
+		Format:     models.FormatPlain,
+		ViewsLeft:  &views,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each view uses one up, and the last one deletes the snippet.
+	for _, want := range []int{1, 0} {
+		s, err = m.View(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Content != "hunter2" || s.ViewsLeft == nil || *s.ViewsLeft != want {
+			t.Errorf("want content %q with %d views left; got %q with %v", "hunter2", want,
+				s.Content, s.ViewsLeft)
+		}
+	}
+
+	if _, err = m.View(id); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+	if _, err = m.Get(id); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+}
+
+func TestSnippetModelPassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := SnippetModel{db}
+
+	password := "correct horse"
+	s := &models.Snippet{
+		UserID:     1,
+		Title:      "Deploy key",
+		Content:    "ssh-ed25519 AAAA...",
+		Visibility: models.VisibilityUnlisted,
+		Language:   "text",
+		Format:     models.FormatPlain,
+		Password:   &password,
+	}
+	id, _, err := m.Insert(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Protected {
+		t.Error("want the snippet protected; got unprotected")
+	}
+
+	if err = m.CheckPassword(id, "correct horse"); err != nil {
+		t.Errorf("want the right password accepted; got %v", err)
+	}
+	if err = m.CheckPassword(id, "wrong horse"); err != models.ErrInvalidCredentials {
+		t.Errorf("want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+	if err = m.CheckPassword(1, "correct horse"); err != models.ErrInvalidCredentials {
+		t.Errorf("want %v for an unprotected snippet; got %v", models.ErrInvalidCredentials, err)
+	}
+
+	// Updating the snippet without a new password keeps the old one, and an empty password
+	// removes it.
+	s.ID, s.Password = id, nil
+	if err = m.Update(s); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.CheckPassword(id, "correct horse"); err != nil {
+		t.Errorf("want the password kept; got %v", err)
+	}
+
+	none := ""
+	s.Password = &none
+	if err = m.Update(s); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = m.Get(id); err != nil {
+		t.Fatal(err)
+	}
+	if got.Protected {
+		t.Error("want the password removed; got protected")
+	}
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := SnippetModel{db}
+
+	// Three snippets expired an hour ago, one expires later and one never expires.
+	now := time.Now().UTC().Truncate(time.Second)
+	expired, later := now.Add(-time.Hour), now.Add(time.Hour)
+	var ids []int
+	for _, expires := range []*time.Time{&expired, &expired, &expired, &later, nil} {
+		id, _, err := m.Insert(&models.Snippet{
+			UserID:     1,
+			Title:      "Title",
+			Content:    "Content",
+			Expires:    expires,
+			Visibility: models.VisibilityPublic,
+			Language:   "text",
+			Format:     models.FormatPlain,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Only the expired snippets are deleted, up to the limit each time.
+	for _, want := range []int{2, 1, 0} {
+		n, err := m.DeleteExpired(now, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("want %d deleted; got %d", want, n)
+		}
+	}
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM snippets WHERE id IN (?, ?, ?, ?, ?)`,
+		ids[0], ids[1], ids[2], ids[3], ids[4]).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 snippets left; got %d", count)
+	}
+
+	// The revisions of deleted snippets are deleted with them.
+	err = db.QueryRow(`SELECT COUNT(*) FROM snippet_revisions WHERE snippet_id = ?`,
+		ids[0]).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("want no revisions left; got %d", count)
+	}
+}
@@ -1,16 +1,5 @@
 USE test_snippetbox;
 
-CREATE TABLE snippets
-(
-    id      INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
-    title   VARCHAR(100) NOT NULL,
-    content TEXT         NOT NULL,
-    created DATETIME     NOT NULL,
-    expires DATETIME     NOT NULL
-);
-
-CREATE INDEX idx_snippets_created ON snippets (created);
-
 CREATE TABLE users
 (
     id              INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
@@ -24,8 +13,142 @@ CREATE TABLE users
 ALTER TABLE users
     ADD CONSTRAINT users_uc_email UNIQUE (email);
 
+CREATE TABLE snippets
+(
+    id            INTEGER                                NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id       INTEGER                                NULL,
+    title         VARCHAR(100)                           NOT NULL,
+    content       TEXT                                   NOT NULL,
+    created       DATETIME                               NOT NULL,
+    updated       DATETIME                               NOT NULL,
+    expires       DATETIME                               NULL,
+    visibility    ENUM ('public', 'unlisted', 'private') NOT NULL DEFAULT 'public',
+    slug          CHAR(22)                               NOT NULL,
+    language      VARCHAR(20)                            NOT NULL DEFAULT 'text',
+    format        ENUM ('plain', 'markdown')             NOT NULL DEFAULT 'plain',
+    views_left    INTEGER                                NULL,
+    password_hash CHAR(60)                               NULL,
+    encrypted     BOOLEAN                                NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_snippets_created ON snippets (created);
+
+CREATE INDEX idx_snippets_expires ON snippets (expires);
+
+CREATE FULLTEXT INDEX idx_snippets_fulltext ON snippets (title, content);
+
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
+
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE TABLE snippet_revisions
+(
+    id         INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER      NOT NULL,
+    user_id    INTEGER      NULL,
+    title      VARCHAR(100) NOT NULL,
+    content    TEXT         NOT NULL,
+    created    DATETIME     NOT NULL
+);
+
+ALTER TABLE snippet_revisions
+    ADD CONSTRAINT snippet_revisions_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE;
+
+ALTER TABLE snippet_revisions
+    ADD CONSTRAINT snippet_revisions_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE TABLE tags
+(
+    id   INTEGER     NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(32) NOT NULL
+);
+
+ALTER TABLE tags
+    ADD CONSTRAINT tags_uc_name UNIQUE (name);
+
+CREATE TABLE snippet_tags
+(
+    snippet_id INTEGER NOT NULL,
+    tag_id     INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, tag_id)
+);
+
+ALTER TABLE snippet_tags
+    ADD CONSTRAINT snippet_tags_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE;
+
+ALTER TABLE snippet_tags
+    ADD CONSTRAINT snippet_tags_fk_tag_id FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE;
+
+CREATE TABLE api_tokens
+(
+    id        INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id   INTEGER      NOT NULL,
+    name      VARCHAR(100) NOT NULL,
+    hash      CHAR(64)     NOT NULL,
+    created   DATETIME     NOT NULL,
+    last_used DATETIME     NULL,
+    expires   DATETIME     NULL
+);
+
+ALTER TABLE api_tokens
+    ADD CONSTRAINT api_tokens_uc_hash UNIQUE (hash);
+
+ALTER TABLE api_tokens
+    ADD CONSTRAINT api_tokens_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE TABLE webhooks
+(
+    id      INTEGER       NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER       NOT NULL,
+    url     VARCHAR(2048) NOT NULL,
+    secret  VARCHAR(255)  NOT NULL,
+    events  SET ('snippet.created', 'snippet.updated', 'snippet.deleted', 'snippet.expired') NOT NULL,
+    created DATETIME      NOT NULL
+);
+ALTER TABLE webhooks
+    ADD CONSTRAINT webhooks_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE TABLE webhook_deliveries
+(
+    id          INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    webhook_id  INTEGER      NOT NULL,
+    event       VARCHAR(32)  NOT NULL,
+    payload     MEDIUMTEXT   NOT NULL,
+    attempt     INTEGER      NOT NULL,
+    status_code INTEGER      NOT NULL,
+    error       VARCHAR(255) NOT NULL,
+    created     DATETIME     NOT NULL
+);
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+ALTER TABLE webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_fk_webhook_id FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE;
+
+CREATE TABLE checkpoints
+(
+    name VARCHAR(64) NOT NULL PRIMARY KEY,
+    time DATETIME    NOT NULL
+);
+
 INSERT INTO users (name, email, hashed_password, created)
 VALUES ('Alice Jones2',
         'alice2@example.com',
         '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
         '2018-12-23 17:25:22');
+
+INSERT INTO snippets (user_id, title, content, created, updated, expires, slug)
+VALUES (1,
+        'An old silent pond',
+        'An old silent pond...',
+        '2018-12-23 17:25:22',
+        '2018-12-23 17:25:22',
+        '2099-12-23 17:25:22',
+        'anOldSilentPond0000001');
+
+INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+VALUES (1,
+        1,
+        'An old silent pond',
+        'An old silent pond...',
+        '2018-12-23 17:25:22');
@@ -1,5 +1,19 @@
 USE test_snippetbox;
 
-DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS checkpoints;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+
+DROP TABLE IF EXISTS webhooks;
+
+DROP TABLE IF EXISTS api_tokens;
+
+DROP TABLE IF EXISTS snippet_tags;
+
+DROP TABLE IF EXISTS tags;
+
+DROP TABLE IF EXISTS snippet_revisions;
 
 DROP TABLE IF EXISTS snippets;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// TokenModel wraps a sql.DB connection pool, and manages personal API tokens.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// tokenPrefix starts every API token, which makes tokens easy to recognise (for example by
+// secret scanners) if they're leaked.
+const tokenPrefix = "sbx_"
+
+// hashToken returns the hex encoded SHA-256 hash of an API token. Tokens are long random
+// strings rather than passwords, so a fast hash is enough to protect them, and lets us look
+// tokens up by their hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Insert creates a new API token with the given name for the user with the given userID. If
+// expires is the zero time, the token never expires. It returns the token itself, which
+// can't be recovered later because only its hash is stored.
+func (m *TokenModel) Insert(userID int, name string, expires time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	stmt := `INSERT INTO api_tokens (user_id, name, hash, created, expires)
+	VALUES(?, ?, ?, UTC_TIMESTAMP(), ?)`
+
+	_, err := m.DB.Exec(stmt, userID, name, hashToken(token), sql.NullTime{
+		Time:  expires,
+		Valid: !expires.IsZero(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// List returns the API tokens of the user with the given userID, newest first.
+func (m *TokenModel) List(userID int) ([]*models.Token, error) {
+	stmt := `SELECT id, user_id, name, created, last_used, expires FROM api_tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.Token{}
+	for rows.Next() {
+		t := &models.Token{}
+		var lastUsed, expires sql.NullTime
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Created, &lastUsed, &expires)
+		if err != nil {
+			return nil, err
+		}
+		t.LastUsed, t.Expires = lastUsed.Time, expires.Time
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes the API token with the given id. Users can only revoke their own tokens,
+// so if the token doesn't exist or belongs to another user, models.ErrNoRecord is returned.
+func (m *TokenModel) Revoke(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// Authenticate returns the ID of the user who owns the given API token, and records that the
+// token has been used. If the token doesn't exist, has expired, or belongs to a deactivated
+// user, models.ErrInvalidCredentials is returned.
+func (m *TokenModel) Authenticate(token string) (int, error) {
+	var id, userID int
+	stmt := `SELECT t.id, t.user_id FROM api_tokens t JOIN users u ON u.id = t.user_id
+	WHERE t.hash = ? AND (t.expires IS NULL OR t.expires > UTC_TIMESTAMP()) AND u.active = TRUE`
+	err := m.DB.QueryRow(stmt, hashToken(token)).Scan(&id, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	_, err = m.DB.Exec(`UPDATE api_tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+func TestTokenModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := TokenModel{db}
+
+	token, err := m.Insert(1, "laptop", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, tokenPrefix) {
+		t.Errorf("want token to start with %q; got %q", tokenPrefix, token)
+	}
+
+	// The token itself authenticates its owner, and records when it was used.
+	userID, err := m.Authenticate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 1 {
+		t.Errorf("want user ID %d; got %d", 1, userID)
+	}
+
+	tokens, err := m.List(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "laptop" || tokens[0].LastUsed.IsZero() {
+		t.Fatalf("want one used token named %q; got %+v", "laptop", tokens)
+	}
+	if !tokens[0].Expires.IsZero() {
+		t.Errorf("want token to never expire; got %v", tokens[0].Expires)
+	}
+
+	// Expired and unknown tokens are rejected.
+	expired, err := m.Insert(1, "old", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range []string{expired, tokenPrefix + "unknown"} {
+		if _, err := m.Authenticate(tok); err != models.ErrInvalidCredentials {
+			t.Errorf("want %v; got %v", models.ErrInvalidCredentials, err)
+		}
+	}
+
+	// Only the owner can revoke a token, and it stops working once revoked.
+	if err := m.Revoke(tokens[0].ID, 2); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+	if err := m.Revoke(tokens[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(token); err != models.ErrInvalidCredentials {
+		t.Errorf("want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+}
@@ -0,0 +1,17 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// rollback aborts the in-progress transaction tx after err occurred. It's important to
+// ALWAYS call either Rollback() or Commit() before returning, otherwise the connection
+// stays open and is not returned to the connection pool. rollback returns the original
+// error, annotated with the rollback error if the transaction couldn't be aborted.
+func rollback(tx *sql.Tx, err error) error {
+	if rb := tx.Rollback(); rb != nil {
+		return fmt.Errorf("%w (unable to abort transaction: %v)", err, rb)
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// WebhookModel wraps a sql.DB connection pool, and manages webhooks and their delivery log.
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Insert registers a new webhook, and returns its ID. The events are stored in a SET
+// column, which MySQL reads and writes as a comma-separated list.
+func (m *WebhookModel) Insert(w *models.Webhook) (int, error) {
+	stmt := `INSERT INTO webhooks (user_id, url, secret, events, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, w.UserID, w.URL, w.Secret, strings.Join(w.Events, ","))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// selectWebhooks is the start of every query which fetches webhooks.
+const selectWebhooks = `SELECT id, user_id, url, secret, events, created FROM webhooks `
+
+// scanWebhook copies the columns selected by selectWebhooks from row into a new Webhook.
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*models.Webhook, error) {
+	w := &models.Webhook{}
+	var events string
+	err := row.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, &events, &w.Created)
+	if err != nil {
+		return nil, err
+	}
+	w.Events = strings.Split(events, ",")
+	return w, nil
+}
+
+// Get returns the webhook with the given id. Users can only see their own webhooks, so if
+// the webhook doesn't exist or belongs to another user, models.ErrNoRecord is returned.
+func (m *WebhookModel) Get(id, userID int) (*models.Webhook, error) {
+	row := m.DB.QueryRow(selectWebhooks+`WHERE id = ? AND user_id = ?`, id, userID)
+
+	w, err := scanWebhook(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// List returns the webhooks of the user with the given userID, newest first.
+func (m *WebhookModel) List(userID int) ([]*models.Webhook, error) {
+	return m.queryWebhooks(selectWebhooks+`WHERE user_id = ? ORDER BY id DESC`, userID)
+}
+
+// Subscribed returns the webhooks of the user with the given userID which are subscribed to
+// the event.
+func (m *WebhookModel) Subscribed(userID int, event string) ([]*models.Webhook, error) {
+	return m.queryWebhooks(selectWebhooks+`WHERE user_id = ? AND FIND_IN_SET(?, events) > 0`,
+		userID, event)
+}
+
+// queryWebhooks runs a query starting with selectWebhooks, and returns the webhooks.
+func (m *WebhookModel) queryWebhooks(stmt string, args ...interface{}) ([]*models.Webhook, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*models.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes the webhook with the given id, along with its delivery log. Users can only
+// delete their own webhooks, so if the webhook doesn't exist or belongs to another user,
+// models.ErrNoRecord is returned.
+func (m *WebhookModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// keptDeliveries is how many delivery attempts are kept for each webhook, which is as many as
+// the webhook's page shows. Older attempts are deleted as new ones are logged, so that the
+// log doesn't grow forever for an endpoint which keeps failing.
+const keptDeliveries = 50
+
+// LogDelivery records an attempt to deliver an event to a webhook, and deletes the attempts
+// older than the latest keptDeliveries. Errors are truncated to fit their column, without
+// splitting a multi-byte character, which MySQL would reject.
+func (m *WebhookModel) LogDelivery(d *models.Delivery) error {
+	if len(d.Error) > 255 {
+		n := 255
+		for n > 0 && !utf8.RuneStart(d.Error[n]) {
+			n--
+		}
+		d.Error = d.Error[:n]
+	}
+
+	stmt := `INSERT INTO webhook_deliveries
+	(webhook_id, event, payload, attempt, status_code, error, created)
+	VALUES(?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, d.WebhookID, d.Event, d.Payload, d.Attempt, d.StatusCode, d.Error)
+	if err != nil {
+		return err
+	}
+
+	// MySQL won't select from the table being deleted from in a subquery, unless the
+	// subquery is wrapped in a derived table. If there aren't more than keptDeliveries
+	// attempts, the subquery is NULL, and nothing is deleted.
+	stmt = `DELETE FROM webhook_deliveries WHERE webhook_id = ? AND id <= (
+		SELECT id FROM (
+			SELECT id FROM webhook_deliveries WHERE webhook_id = ?
+			ORDER BY id DESC LIMIT 1 OFFSET ?
+		) AS oldest
+	)`
+
+	_, err = m.DB.Exec(stmt, d.WebhookID, d.WebhookID, keptDeliveries)
+	return err
+}
+
+// Deliveries returns the most recent delivery attempts for the webhook with the given
+// webhookID, newest first.
+func (m *WebhookModel) Deliveries(webhookID, limit int) ([]*models.Delivery, error) {
+	stmt := `SELECT id, webhook_id, event, payload, attempt, status_code, error, created
+	FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.Delivery{}
+	for rows.Next() {
+		d := &models.Delivery{}
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Attempt, &d.StatusCode,
+			&d.Error, &d.Created)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
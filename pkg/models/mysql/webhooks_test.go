@@ -0,0 +1,117 @@
+package mysql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+func TestWebhookModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := WebhookModel{db}
+
+	events := []string{models.EventSnippetCreated, models.EventSnippetExpired}
+	id, err := m.Insert(&models.Webhook{UserID: 1, URL: "https://example.com/hook",
+		Secret: "0123456789abcdef", Events: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := m.Get(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.URL != "https://example.com/hook" || !reflect.DeepEqual(w.Events, events) {
+		t.Errorf("want webhook for %q with events %q; got %+v", "https://example.com/hook",
+			events, w)
+	}
+
+	// Other users can't see the webhook.
+	if _, err := m.Get(id, 2); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+
+	// Only the subscribed events of the webhook's owner find it.
+	for _, tt := range []struct {
+		userID int
+		event  string
+		want   int
+	}{
+		{1, models.EventSnippetCreated, 1},
+		{1, models.EventSnippetExpired, 1},
+		{1, models.EventSnippetDeleted, 0},
+		{2, models.EventSnippetCreated, 0},
+	} {
+		webhooks, err := m.Subscribed(tt.userID, tt.event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(webhooks) != tt.want {
+			t.Errorf("user %d, %s: want %d webhooks; got %d", tt.userID, tt.event, tt.want,
+				len(webhooks))
+		}
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		err := m.LogDelivery(&models.Delivery{WebhookID: id, Event: models.EventSnippetCreated,
+			Payload: "{}", Attempt: attempt, StatusCode: 500, Error: "Internal Server Error"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deliveries, err := m.Deliveries(id, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].Attempt != 2 {
+		t.Errorf("want 2 deliveries, newest first; got %+v", deliveries)
+	}
+
+	// Long errors are truncated without splitting a character.
+	err = m.LogDelivery(&models.Delivery{WebhookID: id, Event: models.EventSnippetCreated,
+		Payload: "{}", Attempt: 3, Error: strings.Repeat("é", 200)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, err = m.Deliveries(id, 1); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("é", 127); len(deliveries) != 1 || deliveries[0].Error != want {
+		t.Errorf("want the error truncated to %d characters; got %+v", 127, deliveries)
+	}
+
+	// Only the latest attempts are kept.
+	for attempt := 4; attempt <= keptDeliveries+2; attempt++ {
+		err := m.LogDelivery(&models.Delivery{WebhookID: id, Event: models.EventSnippetCreated,
+			Payload: "{}", Attempt: attempt, StatusCode: 500})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if deliveries, err = m.Deliveries(id, 2*keptDeliveries); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != keptDeliveries || deliveries[keptDeliveries-1].Attempt != 3 {
+		t.Errorf("want the latest %d deliveries kept; got %d", keptDeliveries, len(deliveries))
+	}
+
+	// Deleting the webhook deletes its delivery log too.
+	if err := m.Delete(id, 2); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+	if err := m.Delete(id, 1); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, err = m.Deliveries(id, 10); err != nil || len(deliveries) != 0 {
+		t.Errorf("want no deliveries; got %d (%v)", len(deliveries), err)
+	}
+}
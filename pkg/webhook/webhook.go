@@ -0,0 +1,306 @@
+// Package webhook delivers snippet events to the webhooks users have registered. Events are
+// sent in the background as signed JSON payloads, and failed deliveries are retried with
+// exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// Headers sent with every delivery. The signature is the hex encoded HMAC-SHA256 of the
+// request body, keyed with the webhook's secret and prefixed with "sha256=". The delivery ID
+// is the same for every attempt to deliver an event, so that receivers can ignore
+// duplicates.
+const (
+	SignatureHeader = "X-Snippetbox-Signature"
+	EventHeader     = "X-Snippetbox-Event"
+	DeliveryHeader  = "X-Snippetbox-Delivery"
+)
+
+// Store finds the webhooks subscribed to an event, and logs delivery attempts.
+type Store interface {
+	Subscribed(userID int, event string) ([]*models.Webhook, error)
+	LogDelivery(d *models.Delivery) error
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event   string    `json:"event"`
+	Sent    time.Time `json:"sent"`
+	Snippet *Snippet  `json:"snippet"`
+}
+
+// Snippet is the snippet an event is about, as it's sent in payloads. It has everything
+// about the snippet except its content. Deliveries are logged with their payloads, and
+// the content of a burn-after-reading or password-protected snippet mustn't outlive the
+// snippet in the delivery log, so receivers which need the content fetch it from Path, or
+// from the API.
+type Snippet struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Author     string     `json:"author"`
+	Title      string     `json:"title"`
+	Created    time.Time  `json:"created"`
+	Updated    time.Time  `json:"updated"`
+	Expires    *time.Time `json:"expires"`
+	Visibility string     `json:"visibility"`
+	Slug       string     `json:"slug"`
+	// Path is the path of the snippet's page, relative to the application's address.
+	Path      string   `json:"path"`
+	Language  string   `json:"language"`
+	Format    string   `json:"format"`
+	Tags      []string `json:"tags,omitempty"`
+	ViewsLeft *int     `json:"views_left,omitempty"`
+	Protected bool     `json:"protected,omitempty"`
+	Encrypted bool     `json:"encrypted,omitempty"`
+}
+
+// newSnippet returns the payload snippet for s.
+func newSnippet(s *models.Snippet) *Snippet {
+	return &Snippet{
+		ID:         s.ID,
+		UserID:     s.UserID,
+		Author:     s.Author,
+		Title:      s.Title,
+		Created:    s.Created,
+		Updated:    s.Updated,
+		Expires:    s.Expires,
+		Visibility: s.Visibility,
+		Slug:       s.Slug,
+		Path:       "/s/" + s.Slug,
+		Language:   s.Language,
+		Format:     s.Format,
+		Tags:       s.Tags,
+		ViewsLeft:  s.ViewsLeft,
+		Protected:  s.Protected,
+		Encrypted:  s.Encrypted,
+	}
+}
+
+// Sign returns the signature of body for the given secret, in the form sent in the
+// SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body for the given secret.
+// Receivers written in Go can use it to check deliveries.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// job is a unit of work for the dispatcher's workers: either an event to fan out to the
+// subscribed webhooks, or a single attempt to deliver an event to one webhook.
+type job struct {
+	event   string
+	snippet *models.Snippet
+
+	webhook  *models.Webhook
+	id       string
+	body     []byte
+	attempts int
+}
+
+// Dispatcher sends events to webhooks from a pool of background workers. The exported
+// fields can be changed before Start is called.
+type Dispatcher struct {
+	Store Store
+	// Client makes the deliveries. The default client only connects to public addresses.
+	Client   *http.Client
+	ErrorLog *log.Logger
+	// MaxAttempts is the number of times a delivery is attempted before giving up. Backoff
+	// is the delay before the first retry, which doubles for each retry after that.
+	MaxAttempts int
+	Backoff     time.Duration
+
+	queue chan *job
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New returns a dispatcher with the default settings: five attempts per delivery, retried
+// after 10 seconds, then 20, 40 and 80 seconds.
+func New(store Store, errorLog *log.Logger) *Dispatcher {
+	return &Dispatcher{
+		Store:       store,
+		Client:      newClient(),
+		ErrorLog:    errorLog,
+		MaxAttempts: 5,
+		Backoff:     10 * time.Second,
+		queue:       make(chan *job, 100),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start starts the given number of workers.
+func (d *Dispatcher) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+}
+
+// Stop stops the workers, waiting for any deliveries in progress to finish. Queued events
+// and pending retries are dropped.
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// Notify queues an event about a snippet for delivery to its author's webhooks. It never
+// blocks the caller; if the queue is full the event is dropped and logged.
+func (d *Dispatcher) Notify(event string, s *models.Snippet) {
+	// Anonymous snippets have no author, so there's no one to notify.
+	if s.UserID == 0 {
+		return
+	}
+	d.enqueue(&job{event: event, snippet: s}, false)
+}
+
+// enqueue adds a job to the queue. Unless wait is set, the job is dropped if the queue is
+// full. Jobs are always dropped once the dispatcher is stopped.
+func (d *Dispatcher) enqueue(j *job, wait bool) {
+	if !wait {
+		select {
+		case d.queue <- j:
+		case <-d.stop:
+		default:
+			d.ErrorLog.Printf("webhook: queue full, dropping %s event", j.event)
+		}
+		return
+	}
+
+	select {
+	case d.queue <- j:
+	case <-d.stop:
+	}
+}
+
+// work runs jobs from the queue until the dispatcher is stopped.
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case j := <-d.queue:
+			if j.webhook == nil {
+				d.fanOut(j)
+			} else {
+				d.deliver(j)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// fanOut builds the payload for an event and queues a delivery to each subscribed webhook.
+func (d *Dispatcher) fanOut(j *job) {
+	webhooks, err := d.Store.Subscribed(j.snippet.UserID, j.event)
+	if err != nil {
+		d.ErrorLog.Printf("webhook: finding webhooks for %s event: %s", j.event, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(&Payload{
+		Event:   j.event,
+		Sent:    time.Now().UTC(),
+		Snippet: newSnippet(j.snippet),
+	})
+	if err != nil {
+		d.ErrorLog.Printf("webhook: encoding %s event: %s", j.event, err)
+		return
+	}
+
+	for _, w := range webhooks {
+		id, err := newDeliveryID()
+		if err != nil {
+			d.ErrorLog.Printf("webhook: %s", err)
+			return
+		}
+		d.enqueue(&job{event: j.event, webhook: w, id: id, body: body}, false)
+	}
+}
+
+// deliver makes an attempt to deliver an event to a webhook, and logs it. If the attempt
+// fails, a retry is scheduled after an exponentially increasing delay.
+func (d *Dispatcher) deliver(j *job) {
+	j.attempts++
+	delivery := &models.Delivery{
+		WebhookID: j.webhook.ID,
+		Event:     j.event,
+		Payload:   string(j.body),
+		Attempt:   j.attempts,
+	}
+
+	var err error
+	delivery.StatusCode, err = d.send(j)
+	if err != nil {
+		delivery.Error = err.Error()
+	} else if !delivery.OK() {
+		delivery.Error = http.StatusText(delivery.StatusCode)
+	}
+
+	if err := d.Store.LogDelivery(delivery); err != nil {
+		d.ErrorLog.Printf("webhook: logging delivery: %s", err)
+	}
+
+	if delivery.OK() || j.attempts >= d.MaxAttempts {
+		return
+	}
+
+	delay := d.Backoff << (j.attempts - 1)
+	time.AfterFunc(delay, func() {
+		d.enqueue(j, true)
+	})
+}
+
+// send POSTs the event to the webhook, returning the status code of the response.
+func (d *Dispatcher) send(j *job) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, j.webhook.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhook/1.0")
+	req.Header.Set(EventHeader, j.event)
+	req.Header.Set(DeliveryHeader, j.id)
+	req.Header.Set(SignatureHeader, Sign(j.webhook.Secret, j.body))
+
+	rs, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Body.Close()
+
+	// Read (some of) the body, so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(rs.Body, 64<<10))
+
+	return rs.StatusCode, nil
+}
+
+// newDeliveryID returns a random ID for a delivery.
+func newDeliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating delivery ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
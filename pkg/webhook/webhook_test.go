@@ -0,0 +1,310 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDavD/snippetbox/pkg/models"
+)
+
+// store is an in-memory Store which records delivery attempts.
+type store struct {
+	webhooks []*models.Webhook
+
+	mu         sync.Mutex
+	deliveries []*models.Delivery
+	logged     chan struct{}
+}
+
+func newStore(webhooks ...*models.Webhook) *store {
+	return &store{webhooks: webhooks, logged: make(chan struct{}, 100)}
+}
+
+func (s *store) Subscribed(userID int, event string) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	for _, w := range s.webhooks {
+		for _, e := range w.Events {
+			if w.UserID == userID && e == event {
+				webhooks = append(webhooks, w)
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+func (s *store) LogDelivery(d *models.Delivery) error {
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, d)
+	s.mu.Unlock()
+	s.logged <- struct{}{}
+	return nil
+}
+
+// wait waits for n delivery attempts to be logged, and returns every attempt logged so far.
+func (s *store) wait(t *testing.T, n int) []*models.Delivery {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.logged:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for delivery %d", i+1)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.Delivery(nil), s.deliveries...)
+}
+
+// newTestDispatcher returns a started dispatcher with a short backoff, which is stopped
+// when the test finishes. Its client can reach the test receivers on the loopback address.
+func newTestDispatcher(t *testing.T, s Store) *Dispatcher {
+	d := New(s, log.New(io.Discard, "", 0))
+	d.Client = &http.Client{Timeout: 10 * time.Second}
+	d.Backoff = time.Millisecond
+	d.MaxAttempts = 3
+	d.Start(2)
+	t.Cleanup(d.Stop)
+	return d
+}
+
+var snippet = &models.Snippet{ID: 1, UserID: 1, Title: "An old silent pond",
+	Content: "An old silent pond...", Slug: "anOldSilentPond0000001"}
+
+// TestDeliver tests that events are sent to the subscribed webhooks as signed JSON.
+func TestDeliver(t *testing.T) {
+	t.Parallel()
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan request, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- request{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	s := newStore(
+		&models.Webhook{ID: 1, UserID: 1, URL: receiver.URL, Secret: "s3cr3t",
+			Events: []string{models.EventSnippetCreated}},
+		// Not subscribed to the event.
+		&models.Webhook{ID: 2, UserID: 1, URL: receiver.URL, Secret: "s3cr3t",
+			Events: []string{models.EventSnippetDeleted}},
+		// Subscribed to the event, but for another user's snippets.
+		&models.Webhook{ID: 3, UserID: 2, URL: receiver.URL, Secret: "s3cr3t",
+			Events: []string{models.EventSnippetCreated}},
+	)
+	d := newTestDispatcher(t, s)
+
+	d.Notify(models.EventSnippetCreated, snippet)
+
+	deliveries := s.wait(t, 1)
+	if len(deliveries) != 1 || deliveries[0].WebhookID != 1 || !deliveries[0].OK() {
+		t.Fatalf("want one successful delivery to webhook 1; got %+v", deliveries[0])
+	}
+
+	req := <-received
+	if got := req.header.Get(EventHeader); got != models.EventSnippetCreated {
+		t.Errorf("want event %q; got %q", models.EventSnippetCreated, got)
+	}
+	if req.header.Get(DeliveryHeader) == "" {
+		t.Error("want a delivery ID; got none")
+	}
+	if !Verify("s3cr3t", req.body, req.header.Get(SignatureHeader)) {
+		t.Errorf("signature %q doesn't match the body", req.header.Get(SignatureHeader))
+	}
+	if Verify("wrong", req.body, req.header.Get(SignatureHeader)) {
+		t.Error("signature matches the wrong secret")
+	}
+
+	var p Payload
+	if err := json.Unmarshal(req.body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Event != models.EventSnippetCreated || p.Snippet.Slug != snippet.Slug {
+		t.Errorf("want payload for %s of %q; got %+v", models.EventSnippetCreated, snippet.Slug, p)
+	}
+	if p.Snippet.Path != "/s/"+snippet.Slug {
+		t.Errorf("want path %q; got %q", "/s/"+snippet.Slug, p.Snippet.Path)
+	}
+
+	// The content is never sent, since it would be kept in the delivery log.
+	if strings.Contains(deliveries[0].Payload, snippet.Content) {
+		t.Errorf("want no content in the payload; got %s", deliveries[0].Payload)
+	}
+}
+
+// TestRetry tests that failed deliveries are retried, with the same delivery ID, until they
+// succeed or run out of attempts.
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		failures   int
+		wantStatus []int
+	}{
+		{"Succeeds after retries", 2, []int{500, 500, 200}},
+		{"Gives up", 5, []int{500, 500, 500}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var ids []string
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				ids = append(ids, r.Header.Get(DeliveryHeader))
+				if len(ids) <= tt.failures {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer receiver.Close()
+
+			s := newStore(&models.Webhook{ID: 1, UserID: 1, URL: receiver.URL, Secret: "s3cr3t",
+				Events: []string{models.EventSnippetUpdated}})
+			d := newTestDispatcher(t, s)
+
+			d.Notify(models.EventSnippetUpdated, snippet)
+
+			deliveries := s.wait(t, len(tt.wantStatus))
+			for i, want := range tt.wantStatus {
+				if deliveries[i].StatusCode != want || deliveries[i].Attempt != i+1 {
+					t.Errorf("attempt %d: want status %d; got attempt %d with status %d", i+1,
+						want, deliveries[i].Attempt, deliveries[i].StatusCode)
+				}
+			}
+
+			// Make sure there are no more attempts after the last one.
+			time.Sleep(50 * time.Millisecond)
+			if n := len(s.wait(t, 0)); n != len(tt.wantStatus) {
+				t.Errorf("want %d attempts; got %d", len(tt.wantStatus), n)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				if id != ids[0] {
+					t.Errorf("want the same delivery ID for every attempt; got %q", ids)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestUnreachable tests that deliveries to unreachable receivers are logged with an error.
+func TestUnreachable(t *testing.T) {
+	t.Parallel()
+
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	s := newStore(&models.Webhook{ID: 1, UserID: 1, URL: url, Secret: "s3cr3t",
+		Events: []string{models.EventSnippetDeleted}})
+	d := newTestDispatcher(t, s)
+
+	d.Notify(models.EventSnippetDeleted, snippet)
+
+	deliveries := s.wait(t, 3)
+	for _, dl := range deliveries {
+		if dl.StatusCode != 0 || dl.Error == "" {
+			t.Errorf("want no status and an error; got status %d and error %q", dl.StatusCode,
+				dl.Error)
+		}
+	}
+}
+
+// TestAnonymousSnippet tests that no events are sent for snippets without an author.
+func TestAnonymousSnippet(t *testing.T) {
+	t.Parallel()
+
+	s := newStore(&models.Webhook{ID: 1, UserID: 0, URL: "http://localhost", Secret: "s3cr3t",
+		Events: []string{models.EventSnippetCreated}})
+	d := newTestDispatcher(t, s)
+
+	d.Notify(models.EventSnippetCreated, &models.Snippet{ID: 2})
+
+	time.Sleep(50 * time.Millisecond)
+	if n := len(s.wait(t, 0)); n != 0 {
+		t.Errorf("want no deliveries; got %d", n)
+	}
+}
+
+// TestBlockedAddress tests that the default client refuses to deliver to addresses which
+// aren't public, such as the loopback address of the test receiver.
+func TestBlockedAddress(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	s := newStore(&models.Webhook{ID: 1, UserID: 1, URL: receiver.URL, Secret: "s3cr3t",
+		Events: []string{models.EventSnippetCreated}})
+	d := New(s, log.New(io.Discard, "", 0))
+	d.MaxAttempts = 1
+	d.Start(1)
+	defer d.Stop()
+
+	d.Notify(models.EventSnippetCreated, snippet)
+
+	deliveries := s.wait(t, 1)
+	if deliveries[0].StatusCode != 0 || !strings.Contains(deliveries[0].Error, "is not public") {
+		t.Errorf("want the address refused; got status %d and error %q",
+			deliveries[0].StatusCode, deliveries[0].Error)
+	}
+	select {
+	case <-received:
+		t.Error("want no request received; got one")
+	default:
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.31.255.255", false},
+		{"192.168.0.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublic(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("IsPublic(%s): want %t; got %t", tt.ip, tt.want, got)
+		}
+	}
+}
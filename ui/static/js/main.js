@@ -5,4 +5,159 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+// Fill in the embed code on snippet pages, and select it all when it's clicked so that it's
+// easy to copy.
+var embedCodes = document.querySelectorAll("input.embed-code");
+for (var i = 0; i < embedCodes.length; i++) {
+	var input = embedCodes[i];
+	input.value = '<script src="' + window.location.origin + input.dataset.src + '"></script>';
+	input.addEventListener("click", function () {
+		this.select();
+	});
+}
+
+// Encrypted snippets are encrypted with AES-GCM in the browser before they're sent, so the
+// server only ever sees the ciphertext. The key goes in the URL fragment ("#key=..."), which
+// browsers never send to the server, and the content stored is the base64 encoded IV
+// followed by the ciphertext.
+function snippetKey() {
+	var match = /(?:^#|&)key=([A-Za-z0-9_-]+)/.exec(window.location.hash);
+	return match ? fromBase64URL(match[1]) : null;
+}
+
+function toBase64(bytes) {
+	var s = "";
+	for (var i = 0; i < bytes.length; i++) {
+		s += String.fromCharCode(bytes[i]);
+	}
+	return btoa(s);
+}
+
+function fromBase64(s) {
+	var decoded = atob(s);
+	var bytes = new Uint8Array(decoded.length);
+	for (var i = 0; i < decoded.length; i++) {
+		bytes[i] = decoded.charCodeAt(i);
+	}
+	return bytes;
+}
+
+function toBase64URL(bytes) {
+	return toBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function fromBase64URL(s) {
+	s = s.replace(/-/g, "+").replace(/_/g, "/");
+	while (s.length % 4 != 0) {
+		s += "=";
+	}
+	return fromBase64(s);
+}
+
+function importKey(raw) {
+	return crypto.subtle.importKey("raw", raw, {name: "AES-GCM"}, false, ["encrypt", "decrypt"]);
+}
+
+function encryptText(raw, text) {
+	var iv = crypto.getRandomValues(new Uint8Array(12));
+	return importKey(raw).then(function (key) {
+		return crypto.subtle.encrypt({name: "AES-GCM", iv: iv}, key, new TextEncoder().encode(text));
+	}).then(function (ciphertext) {
+		var data = new Uint8Array(iv.length + ciphertext.byteLength);
+		data.set(iv);
+		data.set(new Uint8Array(ciphertext), iv.length);
+		return toBase64(data);
+	});
+}
+
+function decryptText(raw, encoded) {
+	return Promise.resolve().then(function () {
+		var data = fromBase64(encoded);
+		return importKey(raw).then(function (key) {
+			return crypto.subtle.decrypt({name: "AES-GCM", iv: data.slice(0, 12)}, key, data.slice(12));
+		});
+	}).then(function (plaintext) {
+		return new TextDecoder().decode(plaintext);
+	});
+}
+
+// Links and forms which lead to another page of the same snippet keep the key.
+if (window.location.hash) {
+	var keepFragment = document.querySelectorAll("[data-keep-fragment]");
+	for (var i = 0; i < keepFragment.length; i++) {
+		var el = keepFragment[i];
+		if (el.tagName == "FORM") {
+			el.action = el.action.split("#")[0] + window.location.hash;
+		} else {
+			el.href = el.href.split("#")[0] + window.location.hash;
+		}
+	}
+}
+
+// Decrypt encrypted snippets on their page.
+function showDecrypted(el) {
+	var notice = el.querySelector(".encrypted-notice");
+	var key = snippetKey();
+	if (!key) {
+		return;
+	}
+	decryptText(key, el.dataset.ciphertext).then(function (text) {
+		el.querySelector("pre").textContent = text;
+		notice.hidden = true;
+	}, function () {
+		notice.textContent = "This snippet couldn't be decrypted. Check that you have the whole link.";
+	});
+}
+
+var encryptedSnippets = document.querySelectorAll("[data-ciphertext]");
+for (var i = 0; i < encryptedSnippets.length; i++) {
+	showDecrypted(encryptedSnippets[i]);
+}
+
+// Encrypt the content of snippet forms when they're submitted, if asked to. The form is
+// submitted to a URL with the key in its fragment, which the browser keeps when it's
+// redirected to the new snippet's page. When a form comes back with encrypted content (to
+// edit a snippet, or to fix a mistake) it's decrypted again, or if there's no key, left as
+// it is and sent back unchanged.
+function setUpEncryption(form) {
+	var encrypted = form.querySelector("[name=encrypted]");
+	var content = form.querySelector("[name=content]");
+	var key = snippetKey();
+	if (!encrypted) {
+		return;
+	}
+
+	function isEncrypted() {
+		return encrypted.type == "hidden" || encrypted.checked;
+	}
+
+	if (isEncrypted() && content.value != "") {
+		content.readOnly = true;
+		if (key) {
+			decryptText(key, content.value).then(function (text) {
+				content.value = text;
+				content.readOnly = false;
+			}, function () {});
+		}
+	}
+
+	form.addEventListener("submit", function (e) {
+		if (!isEncrypted() || content.readOnly) {
+			return;
+		}
+		e.preventDefault();
+		var raw = key || crypto.getRandomValues(new Uint8Array(32));
+		encryptText(raw, content.value).then(function (ciphertext) {
+			content.value = ciphertext;
+			content.readOnly = true;
+			form.action = form.action.split("#")[0] + "#key=" + toBase64URL(raw);
+			form.submit();
+		});
+	});
+}
+
+var encryptForms = document.querySelectorAll("form[data-encrypt]");
+for (var i = 0; i < encryptForms.length; i++) {
+	setUpEncryption(encryptForms[i]);
+}